@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"gochat/main/internal/migrations"
+)
+
+const migrateUsage = `usage: gochat [flags] migrate <command>
+
+commands:
+  up                apply every pending migration
+  down [steps]      revert the last steps migrations, one by default
+  status            list the migrations and whether they are applied
+  baseline VERSION  mark migrations up to VERSION as applied without running them,
+                    for databases created by hand before migrations were tracked`
+
+// runMigrate runs the migrate subcommand with the arguments following it.
+func runMigrate(ctx context.Context, migrator migrations.Migrator, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch command, args := args[0], args[1:]; command {
+	case "up":
+		if len(args) != 0 {
+			return errors.New(migrateUsage)
+		}
+		migrated, err := migrator.Up(ctx)
+		printMigrations("Applied", migrated)
+		if err == nil && len(migrated) == 0 {
+			fmt.Println("Already up to date")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			return errors.New(migrateUsage)
+		}
+		if len(args) == 1 {
+			var err error
+			steps, err = strconv.Atoi(args[0])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("steps must be a positive number, not %q", args[0])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		printMigrations("Reverted", reverted)
+		return err
+
+	case "status":
+		if len(args) != 0 {
+			return errors.New(migrateUsage)
+		}
+		return printStatus(ctx, migrator)
+
+	case "baseline":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("version must be a number, not %q", args[0])
+		}
+		recorded, err := migrator.Baseline(ctx, version)
+		printMigrations("Marked as applied", recorded)
+		return err
+
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+func printMigrations(action string, done []migrations.Migration) {
+	for _, migration := range done {
+		fmt.Printf("%s %03d_%s\n", action, migration.Version, migration.Name)
+	}
+}
+
+func printStatus(ctx context.Context, migrator migrations.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		name := status.Name
+		if status.IsUnknown {
+			name = "(unknown to this version)"
+		}
+		appliedAt := "pending"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\n", status.Version, name, appliedAt)
+	}
+	return w.Flush()
+}
@@ -1,10 +1,203 @@
+// Package application holds the dependencies shared by every handler, so handlers take the App
+// rather than each listing the stores and helpers it needs.
 package application
 
 import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gochat/main/internal/chat"
+	"gochat/main/internal/config"
+	"gochat/main/internal/mail"
+	"gochat/main/internal/migrations"
+	"gochat/main/internal/ratelimit"
+	"gochat/main/internal/store"
+	"gochat/main/internal/utils/passwords"
+	"gochat/main/internal/utils/requests"
+	"gochat/main/internal/utils/resp"
+	"gochat/main/internal/utils/sessions"
+
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// App stores the resorces shared between requests.
+// App stores the resources shared between requests.
 type App struct {
-	DB *pgxpool.Pool
+	Config config.Config
+	Logger *slog.Logger
+	// DB and Migrator are nil when the app is built from fakes in tests.
+	DB        *pgxpool.Pool
+	Migrator  *migrations.Migrator
+	Templates *template.Template
+	Clock     Clock
+
+	Users              store.UserStore
+	Sessions           store.SessionStore
+	Rooms              store.RoomStore
+	Messages           store.MessageStore
+	DirectMessages     store.DirectMessageStore
+	PasswordResets     store.PasswordResetStore
+	EmailVerifications store.EmailVerificationStore
+	Mailer             mail.Mailer
+	// emails tracks the emails SendEmailInBackground has not finished sending.
+	emails sync.WaitGroup
+
+	Hub           *chat.Hub
+	SessionPolicy sessions.Policy
+	Metrics       *Metrics
+	// TrustedProxies tell the client's address from the proxy's. None are trusted in tests.
+	TrustedProxies requests.TrustedProxies
+
+	LoginIPLimiter       *ratelimit.Limiter
+	LoginUsernameLimiter *ratelimit.Limiter
+	// PasswordResetLimiter limits the reset emails sent to an address.
+	PasswordResetLimiter *ratelimit.Limiter
+	// EmailVerificationLimiter limits the verification emails sent to an address.
+	EmailVerificationLimiter *ratelimit.Limiter
+}
+
+// Clock tells the time, so tests can control it.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the real clock.
+var SystemClock Clock = systemClock{}
+
+// New creates the app with the Postgres backed stores and the configured session store.
+// The hub is created but not started.
+func New(cfg config.Config, db *pgxpool.Pool, templates *template.Template, logger *slog.Logger) (*App, error) {
+	hashers, err := newPasswordHashers(cfg.Argon2)
+	if err != nil {
+		return nil, err
+	}
+	userService := store.NewUserService(db, hashers, store.LockoutPolicy{
+		Threshold:    cfg.Login.LockoutThreshold,
+		BaseDuration: cfg.Login.LockoutBase,
+		MaxDuration:  cfg.Login.LockoutMax,
+	})
+	passwordResetService := store.NewPasswordResetService(db, hashers)
+	emailVerificationService := store.NewEmailVerificationService(db)
+	roomService := store.NewRoomService(db)
+	messageService := store.NewMessageService(db)
+	directMessageService := store.NewDirectMessageService(db)
+
+	sessionStore, err := newSessionStore(cfg, db)
+	if err != nil {
+		return nil, err
+	}
+
+	mailer, err := newMailer(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	trustedProxies, err := requests.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionPolicy := sessions.Policy{
+		IdleTimeout:      cfg.Session.IdleTimeout,
+		AbsoluteLifetime: cfg.Session.AbsoluteLifetime,
+		RenewInterval:    cfg.Session.RenewInterval,
+	}
+
+	app := &App{
+		Config:             cfg,
+		Logger:             logger,
+		DB:                 db,
+		Migrator:           &migrator,
+		Templates:          templates,
+		Clock:              SystemClock,
+		Users:              &userService,
+		Sessions:           sessionStore,
+		Rooms:              &roomService,
+		Messages:           &messageService,
+		DirectMessages:     &directMessageService,
+		PasswordResets:     &passwordResetService,
+		EmailVerifications: &emailVerificationService,
+		Mailer:             mailer,
+		Hub:                chat.NewHub(&messageService, &directMessageService),
+		SessionPolicy:      sessionPolicy,
+		Metrics:            NewMetrics(),
+		TrustedProxies:     trustedProxies,
+	}
+	rateLimits := ratelimit.NewMemoryStore()
+	app.LoginIPLimiter = ratelimit.NewLimiter(rateLimits, "login-ip",
+		ratelimit.Limit{Burst: cfg.Login.IPBurst, Interval: cfg.Login.IPInterval})
+	app.LoginUsernameLimiter = ratelimit.NewLimiter(rateLimits, "login-username",
+		ratelimit.Limit{Burst: cfg.Login.UsernameBurst, Interval: cfg.Login.UsernameInterval})
+	app.PasswordResetLimiter = ratelimit.NewLimiter(rateLimits, "password-reset-email",
+		ratelimit.Limit{Burst: cfg.PasswordReset.EmailBurst, Interval: cfg.PasswordReset.EmailInterval})
+	app.EmailVerificationLimiter = ratelimit.NewLimiter(rateLimits, "email-verification-email",
+		ratelimit.Limit{Burst: cfg.EmailVerification.EmailBurst, Interval: cfg.EmailVerification.EmailInterval})
+	app.registerSourceMetrics()
+	return app, nil
+}
+
+// newPasswordHashers returns the hashers for passwords. New hashes use argon2id with the configured
+// parameters, and bcrypt hashes are still accepted so imported users can sign in and be upgraded.
+func newPasswordHashers(cfg config.Argon2Config) (passwords.Hashers, error) {
+	return passwords.NewHashers(
+		passwords.NewArgon2IdHasher(passwords.Argon2IdParams{
+			Time:    uint32(cfg.Time),
+			Memory:  uint32(cfg.Memory),
+			Threads: uint8(cfg.Threads),
+		}),
+		passwords.BcryptHasher{Cost: passwords.DefaultBcryptCost},
+	)
+}
+
+// newSessionStore creates the configured session backend.
+func newSessionStore(cfg config.Config, db *pgxpool.Pool) (store.SessionStore, error) {
+	switch cfg.Session.Store {
+	case "postgres":
+		sessionService := store.NewSessionService(db)
+		return &sessionService, nil
+	case "memory":
+		return store.NewMemorySessionStore(), nil
+	case "redis":
+		client := resp.NewClient(cfg.Redis.Addr, resp.Options{
+			Password:       cfg.Redis.Password,
+			DB:             cfg.Redis.DB,
+			CommandTimeout: cfg.Redis.CommandTimeout,
+		})
+		return store.NewRedisSessionStore(client, cfg.Redis.KeyPrefix), nil
+	default:
+		return nil, fmt.Errorf("unknown session store %q", cfg.Session.Store)
+	}
+}
+
+// newMailer creates the configured mail transport.
+func newMailer(cfg config.Config, logger *slog.Logger) (mail.Mailer, error) {
+	switch cfg.Mail.Transport {
+	case "log":
+		return mail.NewLogMailer(logger), nil
+	case "file":
+		return mail.NewFileMailer(cfg.Mail.Dir, cfg.Mail.From), nil
+	case "smtp":
+		return mail.NewSMTPMailer(mail.SMTPOptions{
+			Host:     cfg.Mail.SMTPHost,
+			Port:     cfg.Mail.SMTPPort,
+			Username: cfg.Mail.SMTPUsername,
+			Password: cfg.Mail.SMTPPassword,
+			From:     cfg.Mail.From,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.Mail.Transport)
+	}
 }
@@ -0,0 +1,45 @@
+package application
+
+import (
+	"context"
+
+	"gochat/main/internal/mail"
+)
+
+// SendEmailInBackground sends the message without waiting for the mail server, so a slow one does
+// not hold up the response. Failures are logged since there is no one left to tell. Shutdown waits
+// for the email with WaitForEmails.
+func (app *App) SendEmailInBackground(ctx context.Context, message mail.Message) {
+	// The request may be over before the email is sent.
+	ctx = context.WithoutCancel(ctx)
+
+	app.emails.Add(1)
+	go func() {
+		defer app.emails.Done()
+
+		ctx, cancel := context.WithTimeout(ctx, app.Config.Mail.SendTimeout)
+		defer cancel()
+
+		err := app.Mailer.Send(ctx, message)
+		if err != nil {
+			app.Logger.ErrorContext(ctx, "Error sending email", "subject", message.Subject, "err", err)
+		}
+	}()
+}
+
+// WaitForEmails waits for the emails being sent in the background, or until the context is done.
+// Call it once no more requests are being handled, or new emails could keep it waiting.
+func (app *App) WaitForEmails(ctx context.Context) error {
+	sent := make(chan struct{})
+	go func() {
+		app.emails.Wait()
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,55 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"gochat/main/internal/mail"
+)
+
+// blockingMailer holds every email until the test lets it through.
+type blockingMailer struct {
+	release chan struct{}
+	sent    chan mail.Message
+}
+
+func (mailer blockingMailer) Send(ctx context.Context, message mail.Message) error {
+	<-mailer.release
+	mailer.sent <- message
+	return nil
+}
+
+func TestWaitForEmails(t *testing.T) {
+	mailer := blockingMailer{release: make(chan struct{}), sent: make(chan mail.Message, 1)}
+	app := &App{Logger: slog.New(slog.DiscardHandler), Mailer: mailer}
+	app.Config.Mail.SendTimeout = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.SendEmailInBackground(ctx, mail.Message{Subject: "Hello"})
+	// The email outlives the request it was sent from.
+	cancel()
+
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelWait()
+	err := app.WaitForEmails(waitCtx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForEmails with an email being sent = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(mailer.release)
+	err = app.WaitForEmails(context.Background())
+	if err != nil {
+		t.Fatalf("WaitForEmails = %v", err)
+	}
+	select {
+	case message := <-mailer.sent:
+		if message.Subject != "Hello" {
+			t.Errorf("sent %q, want %q", message.Subject, "Hello")
+		}
+	default:
+		t.Error("WaitForEmails returned before the email was sent")
+	}
+}
@@ -0,0 +1,87 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"gochat/main/internal/metrics"
+)
+
+// activeSessionsTimeout bounds counting sessions during a scrape, so a slow store can not hold
+// up the rest of the metrics.
+const activeSessionsTimeout = 5 * time.Second
+
+// Metrics are the values updated as the server runs. Values kept elsewhere, such as the pool's
+// statistics, are read when scraped instead.
+type Metrics struct {
+	Registry *metrics.Registry
+
+	HTTPRequests        *metrics.CounterVec
+	HTTPRequestDuration *metrics.HistogramVec
+	// Logins is labelled by result, success or failure.
+	Logins *metrics.CounterVec
+}
+
+// NewMetrics creates the metrics updated by handlers and middleware.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Registry: metrics.NewRegistry(),
+		HTTPRequests: metrics.NewCounterVec("gochat_http_requests_total",
+			"HTTP requests served, by route, method and status.", "route", "method", "status"),
+		HTTPRequestDuration: metrics.NewHistogramVec("gochat_http_request_duration_seconds",
+			"Time taken to serve HTTP requests, by route. Websocket connections are not included.",
+			metrics.DefaultBuckets, "route"),
+		Logins: metrics.NewCounterVec("gochat_logins_total",
+			"Sign in attempts, by result.", "result"),
+	}
+	m.Registry.Register(m.HTTPRequests, m.HTTPRequestDuration, m.Logins)
+	return m
+}
+
+// registerSourceMetrics adds the metrics read from the app's stores, pool and hub when scraped.
+func (app *App) registerSourceMetrics() {
+	app.Metrics.Registry.Register(
+		metrics.NewGaugeFunc("gochat_active_sessions", "Unexpired sessions.",
+			func(ctx context.Context) (float64, error) {
+				ctx, cancel := context.WithTimeout(ctx, activeSessionsTimeout)
+				defer cancel()
+				count, err := app.Sessions.CountActiveSessions(ctx)
+				return float64(count), err
+			}),
+		metrics.NewGaugeFunc("gochat_chat_clients", "Connected chat websockets.",
+			func(ctx context.Context) (float64, error) {
+				return float64(app.Hub.Stats().Clients), nil
+			}),
+		// Messages per second is the rate of these.
+		metrics.NewCounterFunc("gochat_chat_room_messages_total", "Messages sent to rooms.",
+			func(ctx context.Context) (float64, error) {
+				return float64(app.Hub.Stats().RoomMessages), nil
+			}),
+		metrics.NewCounterFunc("gochat_chat_direct_messages_total", "Direct messages sent.",
+			func(ctx context.Context) (float64, error) {
+				return float64(app.Hub.Stats().DirectMessages), nil
+			}),
+	)
+
+	if app.DB == nil {
+		return
+	}
+	app.Metrics.Registry.Register(
+		metrics.NewGaugeFunc("gochat_db_pool_acquired_conns", "Database connections in use.",
+			func(ctx context.Context) (float64, error) {
+				return float64(app.DB.Stat().AcquiredConns()), nil
+			}),
+		metrics.NewGaugeFunc("gochat_db_pool_idle_conns", "Idle database connections.",
+			func(ctx context.Context) (float64, error) {
+				return float64(app.DB.Stat().IdleConns()), nil
+			}),
+		metrics.NewGaugeFunc("gochat_db_pool_total_conns", "Open database connections.",
+			func(ctx context.Context) (float64, error) {
+				return float64(app.DB.Stat().TotalConns()), nil
+			}),
+		metrics.NewGaugeFunc("gochat_db_pool_max_conns", "Most database connections the pool will open.",
+			func(ctx context.Context) (float64, error) {
+				return float64(app.DB.Stat().MaxConns()), nil
+			}),
+	)
+}
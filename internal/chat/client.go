@@ -0,0 +1,230 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"gochat/main/internal/logging"
+	"gochat/main/internal/store"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the peer.
+	writeWait = 10 * time.Second
+
+	// Time allowed to read the next pong message from the peer.
+	pongWait = 60 * time.Second
+
+	// Send pings to peer with this period. Must be less than pongWait.
+	pingPeriod = (pongWait * 9) / 10
+
+	// Maximum size in bytes of a frame read from the peer.
+	maxFrameSize = 4096
+
+	// MaxMessageLength is the maximum number of characters in a chat message body.
+	MaxMessageLength = 1000
+
+	// Number of outgoing messages buffered per client before it is considered slow.
+	sendBufferSize = 64
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// Client is the middleman between a websocket connection and the hub.
+// Each client posts to either a single room or a direct conversation with a single peer.
+type Client struct {
+	hub    *Hub
+	conn   *websocket.Conn
+	user   store.User
+	roomID int64
+	peerID int64
+	// canPost is false for users who may only read, whose messages are dropped.
+	canPost bool
+	send    chan []byte
+	// closeCode is sent in the close frame once the hub closes send. Zero sends an empty close frame.
+	closeCode int
+	// logger tags the connection's log lines with the request which opened it.
+	logger *slog.Logger
+}
+
+// incomingMessage is the payload clients send when posting in the chat.
+type incomingMessage struct {
+	Body string `json:"body"`
+}
+
+// ServeWebSocket upgrades the request to a websocket connected to the room.
+// The caller is responsible for checking the user is allowed in the room, and whether they can post.
+func ServeWebSocket(hub *Hub, user store.User, roomID int64, canPost bool, w http.ResponseWriter, r *http.Request) error {
+	return serve(hub, &Client{user: user, roomID: roomID, canPost: canPost}, w, r)
+}
+
+// ServeDirectWebSocket upgrades the request to a websocket connected to the user's direct
+// conversation with the peer.
+func ServeDirectWebSocket(hub *Hub, user store.User, peerID int64, canPost bool, w http.ResponseWriter, r *http.Request) error {
+	return serve(hub, &Client{user: user, peerID: peerID, canPost: canPost}, w, r)
+}
+
+// serve upgrades the request and registers the client with the hub.
+func serve(hub *Hub, client *Client, w http.ResponseWriter, r *http.Request) error {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client.
+		return err
+	}
+
+	client.hub = hub
+	client.conn = conn
+	client.logger = slog.With("request_id", logging.RequestID(r.Context()), "user_id", client.user.ID)
+	if client.peerID != 0 {
+		client.logger = client.logger.With("peer_id", client.peerID)
+	} else {
+		client.logger = client.logger.With("room_id", client.roomID)
+	}
+	client.send = make(chan []byte, sendBufferSize)
+	hub.register <- client
+
+	go client.writePump()
+	go client.readPump()
+	return nil
+}
+
+// readPump reads messages from the websocket and hands them to the hub.
+// There is at most one reader per connection, so all reads happen in this goroutine.
+func (client *Client) readPump() {
+	defer func() {
+		client.hub.unregister <- client
+		client.conn.Close()
+	}()
+
+	client.conn.SetReadLimit(maxFrameSize)
+	client.conn.SetReadDeadline(time.Now().Add(pongWait))
+	client.conn.SetPongHandler(func(string) error {
+		client.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		_, payload, err := client.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				client.logger.Warn("Unexpected websocket close", "err", err)
+			}
+			return
+		}
+
+		body, err := parseIncomingMessage(payload)
+		if err != nil {
+			continue
+		}
+
+		// Pages hide the form from users who can not post, so only a client working around it gets here.
+		if !client.canPost {
+			continue
+		}
+
+		if client.peerID != 0 {
+			err = client.postDirectMessage(body)
+		} else {
+			err = client.postRoomMessage(body)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// postRoomMessage saves the message and broadcasts it to the room.
+// Persisting first means every message clients see has an id to page from.
+// An error is only returned when the client should be disconnected.
+func (client *Client) postRoomMessage(body string) error {
+	message, err := client.hub.messageService.CreateMessage(context.Background(), client.roomID, client.user.ID, body)
+	if err != nil {
+		if errors.Is(err, store.ErrNotRoomMember) {
+			// The user left or the room was archived since connecting.
+			return err
+		}
+		client.logger.Error("Failed to save chat message", "err", err)
+		return nil
+	}
+
+	client.hub.Broadcast(NewMessage(message))
+	return nil
+}
+
+// postDirectMessage saves the message and sends it to both participants.
+// An error is only returned when the client should be disconnected.
+func (client *Client) postDirectMessage(body string) error {
+	message, err := client.hub.directMessageService.CreateDirectMessage(context.Background(), client.user.ID, client.peerID, body)
+	if err != nil {
+		if errors.Is(err, store.ErrRecipientNotFound) || errors.Is(err, store.ErrCannotMessageSelf) {
+			return err
+		}
+		client.logger.Error("Failed to save direct message", "err", err)
+		return nil
+	}
+
+	client.hub.SendDirect(NewDirectMessage(message))
+	return nil
+}
+
+// writePump writes queued messages and pings to the websocket.
+// There is at most one writer per connection, so all writes happen in this goroutine.
+func (client *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		client.conn.Close()
+	}()
+
+	for {
+		select {
+		case payload, ok := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The hub closed the channel.
+				closeMessage := []byte{}
+				if client.closeCode != 0 {
+					closeMessage = websocket.FormatCloseMessage(client.closeCode, "")
+				}
+				client.conn.WriteMessage(websocket.CloseMessage, closeMessage)
+				return
+			}
+
+			if err := client.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			client.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+var errInvalidMessage = errors.New("invalid chat message")
+
+func parseIncomingMessage(payload []byte) (string, error) {
+	var message incomingMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		return "", errInvalidMessage
+	}
+
+	body := strings.TrimSpace(message.Body)
+	if len(body) == 0 || len([]rune(body)) > MaxMessageLength {
+		return "", errInvalidMessage
+	}
+
+	return body, nil
+}
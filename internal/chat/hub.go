@@ -0,0 +1,331 @@
+// Package chat contains the websocket hub which fans room messages out to the clients in each room
+// and delivers direct messages to both participants.
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"gochat/main/internal/store"
+
+	"github.com/gorilla/websocket"
+)
+
+// Payload types let clients tell room and direct messages apart on the same connection.
+const (
+	roomMessageType   = "room"
+	directMessageType = "direct"
+)
+
+// Message is the payload sent to clients when a user posts in a room.
+type Message struct {
+	Type     string `json:"type"`
+	ID       int64  `json:"id"`
+	RoomID   int64  `json:"roomId"`
+	UserID   int64  `json:"userId"`
+	Username string `json:"username"`
+	// Name is what the sender is shown as, their display name or else their username.
+	Name   string    `json:"name"`
+	Body   string    `json:"body"`
+	SentAt time.Time `json:"sentAt"`
+}
+
+// NewMessage converts a stored message into the payload sent to clients.
+func NewMessage(message store.Message) Message {
+	return Message{
+		Type:     roomMessageType,
+		ID:       message.ID,
+		RoomID:   message.RoomID,
+		UserID:   message.UserID,
+		Username: message.Username,
+		Name:     message.Name,
+		Body:     message.Body,
+		SentAt:   message.CreatedAt,
+	}
+}
+
+// DirectMessage is the payload sent to both participants when a user sends a direct message.
+type DirectMessage struct {
+	Type        string `json:"type"`
+	ID          int64  `json:"id"`
+	SenderID    int64  `json:"senderId"`
+	RecipientID int64  `json:"recipientId"`
+	Username    string `json:"username"`
+	// Name is what the sender is shown as, their display name or else their username.
+	Name   string    `json:"name"`
+	Body   string    `json:"body"`
+	SentAt time.Time `json:"sentAt"`
+}
+
+// NewDirectMessage converts a stored direct message into the payload sent to clients.
+func NewDirectMessage(message store.DirectMessage) DirectMessage {
+	return DirectMessage{
+		Type:        directMessageType,
+		ID:          message.ID,
+		SenderID:    message.SenderID,
+		RecipientID: message.RecipientID,
+		Username:    message.SenderUsername,
+		Name:        message.SenderName,
+		Body:        message.Body,
+		SentAt:      message.CreatedAt,
+	}
+}
+
+// disconnectRequest asks the hub to drop clients from a room.
+// A zero user id drops every client in the room, and a zero room id drops the user's clients
+// wherever they are connected.
+type disconnectRequest struct {
+	roomID int64
+	userID int64
+}
+
+// Hub keeps track of the connected clients by room and by user and sends messages to them.
+// All of its state is owned by the Run goroutine, everything else talks to it through channels.
+type Hub struct {
+	messageService       store.MessageStore
+	directMessageService store.DirectMessageStore
+
+	rooms      map[int64]map[*Client]bool
+	users      map[int64]map[*Client]bool
+	register   chan *Client
+	unregister chan *Client
+	broadcast  chan Message
+	direct     chan DirectMessage
+	disconnect chan disconnectRequest
+	shutdown   chan struct{}
+
+	// connected holds every client whose read pump is still running, even once removed from the
+	// indexes, since it may still be saving a message.
+	connected map[*Client]bool
+	// closed is set once the hub has shut down, after which clients are turned away.
+	closed bool
+	// drained is closed once the hub has shut down and every client has finished.
+	drained chan struct{}
+
+	// running is set while Run is accepting clients, for readiness checks.
+	running atomic.Bool
+
+	// The counters behind Stats, which are read from other goroutines.
+	clientCount        atomic.Int64
+	roomMessageCount   atomic.Uint64
+	directMessageCount atomic.Uint64
+}
+
+// HubStats are the hub's running totals, for metrics.
+type HubStats struct {
+	// Clients is the number of connections currently in a room or conversation.
+	Clients        int64
+	RoomMessages   uint64
+	DirectMessages uint64
+}
+
+func NewHub(messageService store.MessageStore, directMessageService store.DirectMessageStore) *Hub {
+	return &Hub{
+		messageService:       messageService,
+		directMessageService: directMessageService,
+		rooms:                make(map[int64]map[*Client]bool),
+		users:                make(map[int64]map[*Client]bool),
+		connected:            make(map[*Client]bool),
+		drained:              make(chan struct{}),
+		register:             make(chan *Client),
+		unregister:           make(chan *Client),
+		broadcast:            make(chan Message, 256),
+		direct:               make(chan DirectMessage, 256),
+		disconnect:           make(chan disconnectRequest),
+		shutdown:             make(chan struct{}),
+	}
+}
+
+// Run processes registrations and broadcasts until the program exits.
+// It keeps running after Shutdown so clients still winding down can unregister.
+func (hub *Hub) Run() {
+	hub.running.Store(true)
+	for {
+		select {
+		case client := <-hub.register:
+			hub.connected[client] = true
+			if hub.closed {
+				client.closeCode = websocket.CloseGoingAway
+				close(client.send)
+				continue
+			}
+			addToIndex(hub.users, client.user.ID, client)
+			if client.roomID != 0 {
+				addToIndex(hub.rooms, client.roomID, client)
+			}
+			hub.clientCount.Add(1)
+
+		case client := <-hub.unregister:
+			hub.removeClient(client)
+			delete(hub.connected, client)
+			hub.checkDrained()
+
+		case message := <-hub.broadcast:
+			payload, err := json.Marshal(message)
+			if err != nil {
+				slog.Error("Failed to encode chat message", "room_id", message.RoomID, "err", err)
+				continue
+			}
+			hub.roomMessageCount.Add(1)
+
+			for client := range hub.rooms[message.RoomID] {
+				hub.send(client, payload)
+			}
+
+		case message := <-hub.direct:
+			payload, err := json.Marshal(message)
+			if err != nil {
+				slog.Error("Failed to encode direct message", "err", err)
+				continue
+			}
+			hub.directMessageCount.Add(1)
+
+			// Every connection either participant has open gets the message,
+			// so it can be shown or counted as unread wherever they are.
+			for client := range hub.users[message.SenderID] {
+				hub.send(client, payload)
+			}
+			for client := range hub.users[message.RecipientID] {
+				hub.send(client, payload)
+			}
+
+		case request := <-hub.disconnect:
+			if request.roomID == 0 {
+				for client := range hub.users[request.userID] {
+					hub.removeClient(client)
+				}
+				continue
+			}
+			for client := range hub.rooms[request.roomID] {
+				if request.userID == 0 || client.user.ID == request.userID {
+					hub.removeClient(client)
+				}
+			}
+
+		case <-hub.shutdown:
+			hub.closed = true
+			hub.running.Store(false)
+			for _, clients := range hub.users {
+				for client := range clients {
+					client.closeCode = websocket.CloseGoingAway
+					hub.removeClient(client)
+				}
+			}
+			hub.checkDrained()
+		}
+	}
+}
+
+// Shutdown closes every connection with a going away close frame and waits for the clients to
+// finish, or for the context to be done. It should be called once the HTTP server has stopped
+// handing the hub new connections.
+func (hub *Hub) Shutdown(ctx context.Context) error {
+	select {
+	case hub.shutdown <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-hub.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Broadcast queues the message to be sent to every client connected to its room.
+func (hub *Hub) Broadcast(message Message) {
+	hub.broadcast <- message
+}
+
+// SendDirect queues the direct message to be sent to both of its participants.
+func (hub *Hub) SendDirect(message DirectMessage) {
+	hub.direct <- message
+}
+
+// DisconnectUser closes the user's connections to the room, e.g. after they leave it.
+func (hub *Hub) DisconnectUser(roomID int64, userID int64) {
+	hub.disconnect <- disconnectRequest{roomID: roomID, userID: userID}
+}
+
+// DisconnectUserEverywhere closes every connection the user has, e.g. after they deactivate
+// their account.
+func (hub *Hub) DisconnectUserEverywhere(userID int64) {
+	hub.disconnect <- disconnectRequest{userID: userID}
+}
+
+// DisconnectRoom closes every connection to the room, e.g. after it is archived.
+func (hub *Hub) DisconnectRoom(roomID int64) {
+	hub.disconnect <- disconnectRequest{roomID: roomID}
+}
+
+// Running reports whether the hub has been started and is accepting clients.
+func (hub *Hub) Running() bool {
+	return hub.running.Load()
+}
+
+// Stats returns the hub's running totals.
+func (hub *Hub) Stats() HubStats {
+	return HubStats{
+		Clients:        hub.clientCount.Load(),
+		RoomMessages:   hub.roomMessageCount.Load(),
+		DirectMessages: hub.directMessageCount.Load(),
+	}
+}
+
+// checkDrained closes drained once shutting down has finished.
+func (hub *Hub) checkDrained() {
+	if hub.closed && len(hub.connected) == 0 {
+		select {
+		case <-hub.drained:
+		default:
+			close(hub.drained)
+		}
+	}
+}
+
+// send queues the payload on the client without blocking.
+func (hub *Hub) send(client *Client, payload []byte) {
+	select {
+	case client.send <- payload:
+	default:
+		// The client is not keeping up, drop it rather than blocking everyone else.
+		client.logger.Warn("Dropping slow chat client")
+		hub.removeClient(client)
+	}
+}
+
+func (hub *Hub) removeClient(client *Client) {
+	if _, ok := hub.users[client.user.ID][client]; !ok {
+		// Already removed, e.g. dropped as a slow consumer before it unregistered.
+		return
+	}
+
+	removeFromIndex(hub.users, client.user.ID, client)
+	if client.roomID != 0 {
+		removeFromIndex(hub.rooms, client.roomID, client)
+	}
+	hub.clientCount.Add(-1)
+	close(client.send)
+}
+
+func addToIndex(index map[int64]map[*Client]bool, key int64, client *Client) {
+	clients, ok := index[key]
+	if !ok {
+		clients = make(map[*Client]bool)
+		index[key] = clients
+	}
+	clients[client] = true
+}
+
+func removeFromIndex(index map[int64]map[*Client]bool, key int64, client *Client) {
+	clients := index[key]
+	delete(clients, client)
+	if len(clients) == 0 {
+		delete(index, key)
+	}
+}
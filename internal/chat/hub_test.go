@@ -0,0 +1,19 @@
+package chat
+
+import (
+	"testing"
+
+	"gochat/main/internal/store"
+)
+
+func TestPayloadsShowTheSendersName(t *testing.T) {
+	message := NewMessage(store.Message{Username: "alice", Name: "Alice"})
+	if message.Name != "Alice" || message.Username != "alice" {
+		t.Errorf("room message sent as %q (%q), want %q (%q)", message.Name, message.Username, "Alice", "alice")
+	}
+
+	direct := NewDirectMessage(store.DirectMessage{SenderUsername: "alice", SenderName: "Alice"})
+	if direct.Name != "Alice" || direct.Username != "alice" {
+		t.Errorf("direct message sent as %q (%q), want %q (%q)", direct.Name, direct.Username, "Alice", "alice")
+	}
+}
@@ -0,0 +1,29 @@
+package forms
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ConversationForm starts a direct conversation with another user.
+type ConversationForm struct {
+	Username string
+}
+
+func NewConversationFormFromRequest(r *http.Request) ConversationForm {
+	return ConversationForm{
+		Username: strings.TrimSpace(r.FormValue("username")),
+	}
+}
+
+func (form *ConversationForm) Validate() ValidationErrors {
+	validationErrors := make(ValidationErrors)
+
+	if len(form.Username) == 0 {
+		validationErrors["Username"] = "Username can not be empty."
+	} else if len(form.Username) > 30 {
+		validationErrors["Username"] = "Username can not be greater than 30 characters."
+	}
+
+	return validationErrors
+}
@@ -0,0 +1,33 @@
+package forms
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+type RoomForm struct {
+	Name string
+}
+
+func NewRoomFormFromRequest(r *http.Request) RoomForm {
+	return RoomForm{
+		Name: strings.TrimSpace(r.FormValue("name")),
+	}
+}
+
+var roomNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+func (form *RoomForm) Validate() ValidationErrors {
+	validationErrors := make(ValidationErrors)
+
+	if len(form.Name) == 0 {
+		validationErrors["Name"] = "Room name can not be empty."
+	} else if len(form.Name) > 50 {
+		validationErrors["Name"] = "Room name can not be greater than 50 characters."
+	} else if !roomNamePattern.MatchString(form.Name) {
+		validationErrors["Name"] = "Room name can only contain letters, numbers, dashes and underscores."
+	}
+
+	return validationErrors
+}
@@ -1,12 +1,18 @@
 // Package forms handels form struct mapping and form validation.
 package forms
 
-import "net/http"
+import (
+	"net/http"
+	"net/mail"
+	"strings"
+)
 
 type SignUpForm struct {
 	Username        string
 	Password        string
 	ConfirmPassword string
+	// Email is optional.
+	Email string
 }
 
 func NewSignUpFormFromRequest(r *http.Request) SignUpForm {
@@ -14,6 +20,7 @@ func NewSignUpFormFromRequest(r *http.Request) SignUpForm {
 		Username:        r.FormValue("username"),
 		Password:        r.FormValue("password"),
 		ConfirmPassword: r.FormValue("confirm-password"),
+		Email:           strings.TrimSpace(r.FormValue("email")),
 	}
 }
 
@@ -26,19 +33,28 @@ func (form *SignUpForm) Validate() ValidationErrors {
 		validationErrors["Username"] = "Username can not be greater than 30 characters."
 	}
 
-	if len(form.Password) == 0 {
+	validateNewPassword(validationErrors, form.Password, form.ConfirmPassword)
+
+	if len(form.Email) > 0 {
+		validateEmail(validationErrors, form.Email)
+	}
+
+	return validationErrors
+}
+
+// validateNewPassword checks a password being chosen and its confirmation.
+func validateNewPassword(validationErrors ValidationErrors, password string, confirmPassword string) {
+	if len(password) == 0 {
 		validationErrors["Password"] = "Password can not be empty."
-	} else if len(form.Password) > 64 {
+	} else if len(password) > 64 {
 		validationErrors["Password"] = "Password can not be greater than 64 characters."
 	}
 
-	if len(form.ConfirmPassword) == 0 {
+	if len(confirmPassword) == 0 {
 		validationErrors["ConfirmPassword"] = "Confirm password can not be empty."
-	} else if form.ConfirmPassword != form.Password {
+	} else if confirmPassword != password {
 		validationErrors["ConfirmPassword"] = "Passwords do not match."
 	}
-
-	return validationErrors
 }
 
 type LogInForm struct {
@@ -70,3 +86,157 @@ func (form *LogInForm) Validate() ValidationErrors {
 
 	return validationErrors
 }
+
+type ChangePasswordForm struct {
+	CurrentPassword string
+	Password        string
+	ConfirmPassword string
+}
+
+func NewChangePasswordFormFromRequest(r *http.Request) ChangePasswordForm {
+	return ChangePasswordForm{
+		CurrentPassword: r.FormValue("current-password"),
+		Password:        r.FormValue("password"),
+		ConfirmPassword: r.FormValue("confirm-password"),
+	}
+}
+
+func (form *ChangePasswordForm) Validate() ValidationErrors {
+	validationErrors := make(ValidationErrors)
+
+	if len(form.CurrentPassword) == 0 {
+		validationErrors["CurrentPassword"] = "Current password can not be empty."
+	}
+
+	validateNewPassword(validationErrors, form.Password, form.ConfirmPassword)
+
+	return validationErrors
+}
+
+// MaxDisplayNameLength is the longest display name. It is counted in bytes, so it always fits the
+// column whatever the characters.
+const MaxDisplayNameLength = 50
+
+type DisplayNameForm struct {
+	DisplayName string
+}
+
+func NewDisplayNameFormFromRequest(r *http.Request) DisplayNameForm {
+	return DisplayNameForm{
+		DisplayName: strings.TrimSpace(r.FormValue("display-name")),
+	}
+}
+
+// Validate allows an empty display name, which goes back to showing the username.
+func (form *DisplayNameForm) Validate() ValidationErrors {
+	validationErrors := make(ValidationErrors)
+
+	if len(form.DisplayName) > MaxDisplayNameLength {
+		validationErrors["DisplayName"] = "Display name can not be greater than 50 characters."
+	}
+
+	return validationErrors
+}
+
+type DeactivateAccountForm struct {
+	Password string
+}
+
+func NewDeactivateAccountFormFromRequest(r *http.Request) DeactivateAccountForm {
+	return DeactivateAccountForm{
+		Password: r.FormValue("password"),
+	}
+}
+
+func (form *DeactivateAccountForm) Validate() ValidationErrors {
+	validationErrors := make(ValidationErrors)
+
+	if len(form.Password) == 0 {
+		validationErrors["Password"] = "Password can not be empty."
+	}
+
+	return validationErrors
+}
+
+// MaxEmailLength is the longest email address, which also fits the column.
+const MaxEmailLength = 254
+
+// validateEmail checks an email address, which must be bare rather than one with a name such as
+// "Bob <bob@example.com>".
+func validateEmail(validationErrors ValidationErrors, email string) {
+	if len(email) == 0 {
+		validationErrors["Email"] = "Email can not be empty."
+		return
+	}
+	if len(email) > MaxEmailLength {
+		validationErrors["Email"] = "Email can not be greater than 254 characters."
+		return
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		validationErrors["Email"] = "Email is not a valid email address."
+	}
+}
+
+type EmailForm struct {
+	Email string
+}
+
+func NewEmailFormFromRequest(r *http.Request) EmailForm {
+	return EmailForm{
+		Email: strings.TrimSpace(r.FormValue("email")),
+	}
+}
+
+// Validate allows an empty email, which removes it.
+func (form *EmailForm) Validate() ValidationErrors {
+	validationErrors := make(ValidationErrors)
+
+	if len(form.Email) > 0 {
+		validateEmail(validationErrors, form.Email)
+	}
+
+	return validationErrors
+}
+
+type ForgotPasswordForm struct {
+	Email string
+}
+
+func NewForgotPasswordFormFromRequest(r *http.Request) ForgotPasswordForm {
+	return ForgotPasswordForm{
+		Email: strings.TrimSpace(r.FormValue("email")),
+	}
+}
+
+func (form *ForgotPasswordForm) Validate() ValidationErrors {
+	validationErrors := make(ValidationErrors)
+
+	validateEmail(validationErrors, form.Email)
+
+	return validationErrors
+}
+
+type ResetPasswordForm struct {
+	Token           string
+	Password        string
+	ConfirmPassword string
+}
+
+func NewResetPasswordFormFromRequest(r *http.Request) ResetPasswordForm {
+	return ResetPasswordForm{
+		Token:           r.FormValue("token"),
+		Password:        r.FormValue("password"),
+		ConfirmPassword: r.FormValue("confirm-password"),
+	}
+}
+
+// Validate leaves checking the token to the store, an empty one is simply not found.
+func (form *ResetPasswordForm) Validate() ValidationErrors {
+	validationErrors := make(ValidationErrors)
+
+	validateNewPassword(validationErrors, form.Password, form.ConfirmPassword)
+
+	return validationErrors
+}
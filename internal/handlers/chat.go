@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/chat"
+	"gochat/main/internal/store"
+)
+
+// CreateWebSocketHandler upgrades authenticated requests to a websocket. The connection posts to the
+// room given by the room query parameter, or to the direct conversation with the user given by the dm
+// query parameter. Only members of a room which is not archived may connect to it. Users who can not
+// post are still connected, so they see new messages.
+func CreateWebSocketHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		if query.Has("dm") {
+			serveDirectWebSocket(w, r, app, user, query.Get("dm"))
+			return
+		}
+
+		roomID, err := strconv.ParseInt(query.Get("room"), 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		room, err := app.Rooms.GetRoom(r.Context(), roomID, user.ID)
+		if err != nil {
+			if errors.Is(err, store.ErrRoomNotFound) {
+				http.NotFound(w, r)
+			} else {
+				app.Logger.ErrorContext(r.Context(), "Error getting room for websocket", "room_id", roomID, "err", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if !room.IsMember || room.IsArchived() {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		// Upgrade writes its own error response on failure.
+		_ = chat.ServeWebSocket(app.Hub, user, room.ID, canPost(app, user), w, r)
+	}
+}
+
+func serveDirectWebSocket(w http.ResponseWriter, r *http.Request, app *application.App, user store.User, peerIDValue string) {
+	peerID, err := strconv.ParseInt(peerIDValue, 10, 64)
+	if err != nil || peerID == user.ID {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	peer, err := app.Users.GetUserByID(r.Context(), peerID)
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			http.NotFound(w, r)
+		} else {
+			app.Logger.ErrorContext(r.Context(), "Error getting user for websocket", "peer_id", peerID, "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Upgrade writes its own error response on failure.
+	_ = chat.ServeDirectWebSocket(app.Hub, user, peer.ID, canPost(app, user), w, r)
+}
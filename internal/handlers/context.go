@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gochat/main/internal/models"
+	"gochat/main/internal/store"
+	"gochat/main/internal/utils/sessions"
+)
+
+// currentUser returns the user AuthMiddleware attached to the request, if any.
+func currentUser(r *http.Request) (store.User, bool) {
+	user, ok := r.Context().Value(sessions.UserContextKey).(store.User)
+	return user, ok
+}
+
+// currentSession returns the session AuthMiddleware attached to the request, if any.
+func currentSession(r *http.Request) (models.Session, bool) {
+	session, ok := r.Context().Value(sessions.SessionContextKey).(models.Session)
+	return session, ok
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/chat"
+	"gochat/main/internal/forms"
+	"gochat/main/internal/store"
+	"gochat/main/internal/utils/responses"
+)
+
+func CreateConversationsHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		conversations, err := app.DirectMessages.ListConversations(r.Context(), user.ID)
+		if err != nil {
+			app.Logger.ErrorContext(r.Context(), "Error listing conversations", "err", err)
+			responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "conversations.html", map[string]any{
+				"errors": map[string]string{},
+				"form":   forms.ConversationForm{},
+			})
+			return
+		}
+
+		responses.RenderTemplate(w, r, app.Templates, "conversations.html", map[string]any{
+			"errors":        map[string]string{},
+			"form":          forms.ConversationForm{},
+			"conversations": conversations,
+		})
+	}
+}
+
+// CreateStartConversationHandler looks up the user to message by username and redirects to the conversation.
+func CreateStartConversationHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		conversationForm := forms.NewConversationFormFromRequest(r)
+
+		renderWithErrors := func(validationErrors forms.ValidationErrors) {
+			conversations, err := app.DirectMessages.ListConversations(r.Context(), user.ID)
+			if err != nil {
+				app.Logger.ErrorContext(r.Context(), "Error listing conversations", "err", err)
+			}
+
+			w.WriteHeader(http.StatusBadRequest)
+			responses.RenderTemplate(w, r, app.Templates, "conversations.html", map[string]any{
+				"errors":        validationErrors,
+				"form":          conversationForm,
+				"conversations": conversations,
+			})
+		}
+
+		validationErrors := conversationForm.Validate()
+		if len(validationErrors) > 0 {
+			renderWithErrors(validationErrors)
+			return
+		}
+
+		peer, err := app.Users.GetUserByUsername(r.Context(), conversationForm.Username)
+		if err != nil {
+			if errors.Is(err, store.ErrUserNotFound) {
+				renderWithErrors(forms.ValidationErrors{
+					"Username": "We couldn't find a user with this username.",
+				})
+			} else {
+				app.Logger.ErrorContext(r.Context(), "Error getting user by username", "err", err)
+				responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "conversations.html", map[string]any{
+					"errors": map[string]string{},
+					"form":   conversationForm,
+				})
+			}
+			return
+		}
+
+		if peer.ID == user.ID {
+			renderWithErrors(forms.ValidationErrors{
+				"Username": "You can not message yourself.",
+			})
+			return
+		}
+
+		http.Redirect(w, r, conversationURL(peer.ID), http.StatusSeeOther)
+	}
+}
+
+func CreateConversationHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		peer, ok := getPeerFromPath(w, r, app, user)
+		if !ok {
+			return
+		}
+
+		// Opening the conversation reads everything in it.
+		err := app.DirectMessages.MarkConversationRead(r.Context(), user.ID, peer.ID)
+		if err != nil {
+			app.Logger.ErrorContext(r.Context(), "Error marking conversation read", "peer_id", peer.ID, "err", err)
+		}
+
+		responses.RenderTemplate(w, r, app.Templates, "conversation.html", map[string]any{
+			"peer":             peer,
+			"canPost":          canPost(app, user),
+			"maxMessageLength": chat.MaxMessageLength,
+		})
+	}
+}
+
+// CreateDirectMessageHistoryHandler returns a page of the conversation between the user and the peer as JSON.
+// Only the two participants can ever see the messages as they are selected by the current user's id.
+func CreateDirectMessageHistoryHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			responses.WriteJSON(w, http.StatusUnauthorized, map[string]any{"error": "unauthorized"})
+			return
+		}
+
+		peerID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			responses.WriteJSON(w, http.StatusNotFound, map[string]any{"error": "user not found"})
+			return
+		}
+
+		page, err := parseMessagePage(r)
+		if err != nil {
+			responses.WriteJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+			return
+		}
+
+		storedMessages, err := app.DirectMessages.GetDirectMessages(r.Context(), user.ID, peerID, page)
+		if err != nil {
+			app.Logger.ErrorContext(r.Context(), "Error getting direct messages", "peer_id", peerID, "err", err)
+			responses.WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "internal error"})
+			return
+		}
+
+		messages := make([]chat.DirectMessage, 0, len(storedMessages))
+		for _, message := range storedMessages {
+			messages = append(messages, chat.NewDirectMessage(message))
+		}
+
+		responses.WriteJSON(w, http.StatusOK, map[string]any{
+			"messages": messages,
+			"hasMore":  len(messages) == page.Limit,
+		})
+	}
+}
+
+// CreateMarkConversationReadHandler marks the peer's messages to the user as read.
+// The chat page calls it when a message arrives while the conversation is open.
+func CreateMarkConversationReadHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			responses.WriteJSON(w, http.StatusUnauthorized, map[string]any{"error": "unauthorized"})
+			return
+		}
+
+		peerID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			responses.WriteJSON(w, http.StatusNotFound, map[string]any{"error": "user not found"})
+			return
+		}
+
+		err = app.DirectMessages.MarkConversationRead(r.Context(), user.ID, peerID)
+		if err != nil {
+			app.Logger.ErrorContext(r.Context(), "Error marking conversation read", "peer_id", peerID, "err", err)
+			responses.WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "internal error"})
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func conversationURL(peerID int64) string {
+	return fmt.Sprintf("/dm/%d", peerID)
+}
+
+// getPeerFromPath loads the other participant named by the id path value, writing an error response if it can't.
+func getPeerFromPath(w http.ResponseWriter, r *http.Request, app *application.App, user store.User) (store.User, bool) {
+	peerID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || peerID == user.ID {
+		http.NotFound(w, r)
+		return store.User{}, false
+	}
+
+	peer, err := app.Users.GetUserByID(r.Context(), peerID)
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			http.NotFound(w, r)
+		} else {
+			app.Logger.ErrorContext(r.Context(), "Error getting user", "peer_id", peerID, "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return store.User{}, false
+	}
+	return peer, true
+}
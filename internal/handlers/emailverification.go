@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/mail"
+	"gochat/main/internal/store"
+	"gochat/main/internal/utils/responses"
+)
+
+// CreateVerifyEmailGetHandler asks the user to confirm verifying their email with the token from
+// the emailed link. Verifying only on the POST keeps mail scanners which follow links from using
+// up the token.
+func CreateVerifyEmailGetHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The token is in the URL, which browsers would otherwise send on to any linked site.
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		responses.RenderTemplate(w, r, app.Templates, "verify-email.html", map[string]any{
+			"token": r.URL.Query().Get("token"),
+		})
+	}
+}
+
+// CreateVerifyEmailHandler marks the email the token was sent to as verified.
+func CreateVerifyEmailHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		token := r.FormValue("token")
+
+		userID, err := app.EmailVerifications.VerifyEmail(r.Context(), token)
+		if err != nil {
+			if errors.Is(err, store.ErrVerificationTokenInvalid) {
+				w.WriteHeader(http.StatusBadRequest)
+				responses.RenderTemplate(w, r, app.Templates, "verify-email.html", map[string]any{
+					"isTokenInvalid": true,
+				})
+			} else if errors.Is(err, store.ErrEmailTaken) {
+				// Only the owner of the email has the link, so they may know who else has it.
+				w.WriteHeader(http.StatusBadRequest)
+				responses.RenderTemplate(w, r, app.Templates, "verify-email.html", map[string]any{
+					"isEmailTaken": true,
+				})
+			} else {
+				responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "verify-email.html", map[string]any{
+					"token": token,
+				})
+				app.Logger.ErrorContext(r.Context(), "Error verifying email", "err", err)
+			}
+			return
+		}
+
+		// Chats decide whether the user can post when they connect, so the ones opened before the
+		// email was verified are closed to reconnect able to post.
+		if app.Config.EmailVerification.RequiredToPost {
+			app.Hub.DisconnectUserEverywhere(userID)
+		}
+
+		responses.RenderTemplate(w, r, app.Templates, "verify-email.html", map[string]any{
+			"isVerified": true,
+		})
+	}
+}
+
+// CreateResendVerificationHandler emails the current user a new link to verify their email.
+func CreateResendVerificationHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		// Nothing to verify, most likely the form was submitted from an old page.
+		if user.Email == "" || user.IsEmailVerified() {
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+
+		err := sendEmailVerification(r, app, user)
+		if err != nil {
+			responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "settings.html", settingsData(app, user, map[string]any{}))
+			app.Logger.ErrorContext(r.Context(), "Error sending email verification", "err", err)
+			return
+		}
+
+		http.Redirect(w, r, "/settings?updated=verification-sent", http.StatusSeeOther)
+	}
+}
+
+// sendEmailVerification emails a link to verify the user's email, unless the address has already
+// been sent too many. When another user has verified the email it is theirs, so they are told
+// someone gave it instead, and the user is not told either way.
+func sendEmailVerification(r *http.Request, app *application.App, user store.User) error {
+	// Emails are folded so changing case does not earn more of them.
+	result, err := app.EmailVerificationLimiter.Allow(r.Context(), strings.ToLower(user.Email), app.Clock.Now())
+	if err != nil {
+		return err
+	}
+	if !result.Allowed {
+		return nil
+	}
+
+	owner, err := app.Users.GetUserByEmail(r.Context(), user.Email)
+	if err == nil && owner.ID != user.ID {
+		sendEmailTakenNotice(r, app, owner)
+		return nil
+	}
+	if err != nil && !errors.Is(err, store.ErrUserNotFound) {
+		return err
+	}
+
+	token, err := generateEmailToken()
+	if err != nil {
+		return err
+	}
+	err = app.EmailVerifications.CreateEmailVerificationToken(r.Context(), token, user.ID, user.Email, app.Config.EmailVerification.TokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := strings.TrimSuffix(app.Config.Server.PublicURL, "/") + "/verify-email?" + url.Values{"token": {token}}.Encode()
+	message := mail.Message{
+		To:      user.Email,
+		Subject: "Verify your GoChat email",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"This email was given for the GoChat account %s. Follow this link within %s to confirm it is yours:\n\n"+
+			"%s\n\n"+
+			"If you don't know the account, ignore this email and it will not be verified.\n",
+			user.Name(), user.Username, formatLinkLifetime(app.Config.EmailVerification.TokenTTL), link),
+	}
+
+	app.SendEmailInBackground(r.Context(), message)
+	return nil
+}
+
+// sendEmailTakenNotice tells the owner of an email that it was given for another account.
+func sendEmailTakenNotice(r *http.Request, app *application.App, owner store.User) {
+	message := mail.Message{
+		To:      owner.Email,
+		Subject: "Your email was given for another GoChat account",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone gave this email for another GoChat account, but it is verified for yours, %s. It "+
+			"stays yours and the other account can not use it.\n\n"+
+			"If it was you, sign in as %s instead, or use another email for the new account.\n",
+			owner.Name(), owner.Username, owner.Username),
+	}
+	app.SendEmailInBackground(r.Context(), message)
+}
+
+// formatLinkLifetime describes how long an emailed link works, in hours when it is a whole number
+// of them, since verification links last a day by default.
+func formatLinkLifetime(ttl time.Duration) string {
+	if ttl < time.Hour || ttl%time.Hour != 0 {
+		return formatRetryAfter(int(ttl.Seconds()))
+	}
+
+	hours := int(ttl / time.Hour)
+	if hours == 1 {
+		return "1 hour"
+	}
+	return strconv.Itoa(hours) + " hours"
+}
+
+// canPost reports whether the user may post in rooms and direct conversations, which needs a
+// verified email when the server is configured to require one.
+func canPost(app *application.App, user store.User) bool {
+	return !app.Config.EmailVerification.RequiredToPost || user.IsEmailVerified()
+}
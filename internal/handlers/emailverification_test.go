@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/chat"
+	"gochat/main/internal/mail"
+	"gochat/main/internal/store"
+	"gochat/main/internal/store/storetest"
+)
+
+// verifyLinkPattern finds the verification link in an email.
+var verifyLinkPattern = regexp.MustCompile(`http://localhost:8080/verify-email\?token=[A-Za-z0-9_-]+`)
+
+// newEmailVerificationTestApp returns an app with a mailer to read the verification emails it sends.
+func newEmailVerificationTestApp() (*application.App, *storetest.UserStore, chan mail.Message) {
+	userStore := storetest.NewUserStore()
+	app := newTestApp(userStore, store.NewMemorySessionStore())
+	app.EmailVerifications = storetest.NewEmailVerificationStore(userStore)
+	messages := make(chan mail.Message, 10)
+	app.Mailer = recordingMailer{messages: messages}
+	app.Hub = chat.NewHub(nil, nil)
+	go app.Hub.Run()
+	return app, userStore, messages
+}
+
+// receiveVerificationToken returns the token from the next verification email sent to the address.
+func receiveVerificationToken(t *testing.T, messages chan mail.Message, to string) string {
+	t.Helper()
+
+	select {
+	case message := <-messages:
+		if message.To != to {
+			t.Errorf("email sent to %q, want %q", message.To, to)
+		}
+		link := verifyLinkPattern.FindString(message.Body)
+		if link == "" {
+			t.Fatalf("no verification link in %q", message.Body)
+		}
+		parsed, err := url.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Query().Get("token")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email sent")
+		return ""
+	}
+}
+
+func verifyEmail(app *application.App, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	CreateVerifyEmailHandler(app)(w, newFormRequest(http.MethodPost, "/verify-email", url.Values{"token": {token}}))
+	return w
+}
+
+func TestSignUpVerifiesEmail(t *testing.T) {
+	app, userStore, messages := newEmailVerificationTestApp()
+
+	form := url.Values{"username": {"alice"}, "password": {"password123"}, "confirm-password": {"password123"}, "email": {"alice@example.com"}}
+	w := httptest.NewRecorder()
+	CreateUserHandler(app)(w, newFormRequest(http.MethodPost, "/signup", form))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login?verification-sent" {
+		t.Fatalf("response = %d %q, want a redirect to /login?verification-sent", w.Code, w.Header().Get("Location"))
+	}
+
+	alice, err := userStore.GetUserByUsername(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.IsEmailVerified() {
+		t.Error("email is verified before following the link")
+	}
+
+	token := receiveVerificationToken(t, messages, "alice@example.com")
+
+	// Opening the link only asks to confirm, so a mail scanner following it does not use it up.
+	w = httptest.NewRecorder()
+	CreateVerifyEmailGetHandler(app)(w, httptest.NewRequest(http.MethodGet, "/verify-email?token="+token, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), token) {
+		t.Errorf("verify page response = %d, want %d with the token in its form", w.Code, http.StatusOK)
+	}
+
+	w = verifyEmail(app, token)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Your email has been verified.") {
+		t.Errorf("verify response = %d, want %d saying the email is verified", w.Code, http.StatusOK)
+	}
+
+	alice, err = userStore.GetUserByUsername(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !alice.IsEmailVerified() {
+		t.Error("email is not verified after following the link")
+	}
+
+	// The token only works once.
+	w = verifyEmail(app, token)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "This verification link is invalid or has expired.") {
+		t.Errorf("reused token response = %d, want %d saying the link is invalid", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestTakenEmailIsNotRevealed(t *testing.T) {
+	tests := []struct {
+		name string
+		// giveEmail gives bob's email for alice's account and returns the response.
+		giveEmail    func(t *testing.T, app *application.App) *httptest.ResponseRecorder
+		wantLocation string
+	}{
+		{
+			name: "signing up",
+			giveEmail: func(t *testing.T, app *application.App) *httptest.ResponseRecorder {
+				form := url.Values{"username": {"alice"}, "password": {"password123"}, "confirm-password": {"password123"}, "email": {"BOB@example.com"}}
+				w := httptest.NewRecorder()
+				CreateUserHandler(app)(w, newFormRequest(http.MethodPost, "/signup", form))
+				return w
+			},
+			wantLocation: "/login?verification-sent",
+		},
+		{
+			name: "changing email",
+			giveEmail: func(t *testing.T, app *application.App) *httptest.ResponseRecorder {
+				alice, err := app.Users.CreateUser("alice", "password123", "", context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				r := signIn(t, newFormRequest(http.MethodPost, "/settings/email", url.Values{"email": {"BOB@example.com"}}), app.Sessions, alice, "session-id")
+				w := httptest.NewRecorder()
+				CreateChangeEmailHandler(app)(w, r)
+				return w
+			},
+			wantLocation: "/settings?updated=email",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app, userStore, messages := newEmailVerificationTestApp()
+			bob := userStore.AddUser("bob", "password123")
+			_, err := userStore.UpdateEmail(context.Background(), bob.ID, "bob@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			userStore.MarkEmailVerified(bob.ID)
+
+			// The response is the same as for an email nobody has.
+			w := test.giveEmail(t, app)
+			if w.Code != http.StatusSeeOther || w.Header().Get("Location") != test.wantLocation {
+				t.Fatalf("response = %d %q, want a redirect to %s", w.Code, w.Header().Get("Location"), test.wantLocation)
+			}
+
+			alice, err := userStore.GetUserByUsername(context.Background(), "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if alice.Email != "BOB@example.com" || alice.IsEmailVerified() {
+				t.Errorf("alice's email = %q, verified = %t, want it given but unverified", alice.Email, alice.IsEmailVerified())
+			}
+
+			// Bob is told instead, and no link is sent which could verify his email for alice.
+			select {
+			case message := <-messages:
+				if message.To != "bob@example.com" || verifyLinkPattern.MatchString(message.Body) {
+					t.Errorf("sent %q to %q, want a notice without a link sent to bob", message.Body, message.To)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no email sent")
+			}
+			if tokens := app.EmailVerifications.(*storetest.EmailVerificationStore).Tokens(); tokens != 0 {
+				t.Errorf("stored %d tokens, want none", tokens)
+			}
+		})
+	}
+}
+
+func TestCreateVerifyEmailHandlerRejectsEmailVerifiedByAnotherUser(t *testing.T) {
+	app, userStore, messages := newEmailVerificationTestApp()
+	bob := userStore.AddUser("bob", "password123")
+	bob, err := userStore.UpdateEmail(context.Background(), bob.ID, "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sendEmailVerification(httptest.NewRequest(http.MethodPost, "/settings/email/verify", nil), app, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := receiveVerificationToken(t, messages, "bob@example.com")
+
+	// Someone else with the same email verified it before bob followed his link.
+	robert := userStore.AddUser("robert", "password123")
+	_, err = userStore.UpdateEmail(context.Background(), robert.ID, "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userStore.MarkEmailVerified(robert.ID)
+
+	w := verifyEmail(app, token)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Another account has already verified this email") {
+		t.Errorf("response = %d, want %d saying another account verified the email", w.Code, http.StatusBadRequest)
+	}
+	bob, err = userStore.GetUserByID(context.Background(), bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.IsEmailVerified() {
+		t.Error("email verified for a second user")
+	}
+}
+
+func TestEmailChangesCloseChats(t *testing.T) {
+	t.Run("verifying", func(t *testing.T) {
+		app, userStore, messages := newEmailVerificationTestApp()
+		app.Config.EmailVerification.RequiredToPost = true
+		bob := userStore.AddUser("bob", "password123")
+		bob, err := userStore.UpdateEmail(context.Background(), bob.ID, "bob@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sendEmailVerification(httptest.NewRequest(http.MethodPost, "/settings/email/verify", nil), app, bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token := receiveVerificationToken(t, messages, "bob@example.com")
+
+		// Opened while bob could not post.
+		conn := connectChat(t, app, bob)
+		w := verifyEmail(app, token)
+		if w.Code != http.StatusOK {
+			t.Fatalf("verify status = %d, want %d", w.Code, http.StatusOK)
+		}
+		if !waitForClose(t, conn) {
+			t.Error("chat opened before verifying was not closed")
+		}
+	})
+
+	t.Run("changing to an unverified email", func(t *testing.T) {
+		app, userStore, _ := newEmailVerificationTestApp()
+		app.Config.EmailVerification.RequiredToPost = true
+		bob := userStore.AddUser("bob", "password123")
+		_, err := userStore.UpdateEmail(context.Background(), bob.ID, "bob@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bob = userStore.MarkEmailVerified(bob.ID)
+
+		// Opened while bob could post.
+		conn := connectChat(t, app, bob)
+		r := signIn(t, newFormRequest(http.MethodPost, "/settings/email", url.Values{"email": {"robert@example.com"}}), app.Sessions, bob, "session-id")
+		w := httptest.NewRecorder()
+		CreateChangeEmailHandler(app)(w, r)
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusSeeOther)
+		}
+		if !waitForClose(t, conn) {
+			t.Error("chat opened with the verified email was not closed")
+		}
+	})
+}
+
+func TestCreateVerifyEmailHandlerRejectsChangedEmail(t *testing.T) {
+	app, userStore, messages := newEmailVerificationTestApp()
+	bob := userStore.AddUser("bob", "password123")
+	bob, err := userStore.UpdateEmail(context.Background(), bob.ID, "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sendEmailVerification(httptest.NewRequest(http.MethodPost, "/settings/email/verify", nil), app, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := receiveVerificationToken(t, messages, "bob@example.com")
+
+	_, err = userStore.UpdateEmail(context.Background(), bob.ID, "robert@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := verifyEmail(app, token)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	bob, err = userStore.GetUserByID(context.Background(), bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.IsEmailVerified() {
+		t.Error("new email verified by a link sent to the old one")
+	}
+}
+
+func TestCreateResendVerificationHandler(t *testing.T) {
+	app, userStore, messages := newEmailVerificationTestApp()
+	bob := userStore.AddUser("bob", "password123")
+	bob, err := userStore.UpdateEmail(context.Background(), bob.ID, "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := signIn(t, httptest.NewRequest(http.MethodPost, "/settings/email/verify", nil), app.Sessions, bob, "session-id")
+	w := httptest.NewRecorder()
+	CreateResendVerificationHandler(app)(w, r)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/settings?updated=verification-sent" {
+		t.Fatalf("response = %d %q, want a redirect to /settings?updated=verification-sent", w.Code, w.Header().Get("Location"))
+	}
+
+	token := receiveVerificationToken(t, messages, "bob@example.com")
+	w = verifyEmail(app, token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// Once verified there is nothing to resend.
+	bob, err = userStore.GetUserByID(context.Background(), bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = signIn(t, httptest.NewRequest(http.MethodPost, "/settings/email/verify", nil), app.Sessions, bob, "other-session-id")
+	w = httptest.NewRecorder()
+	CreateResendVerificationHandler(app)(w, r)
+	if w.Header().Get("Location") != "/settings" {
+		t.Errorf("Location = %q, want /settings", w.Header().Get("Location"))
+	}
+	if tokens := app.EmailVerifications.(*storetest.EmailVerificationStore).Tokens(); tokens != 0 {
+		t.Errorf("stored %d tokens, want none", tokens)
+	}
+}
+
+func TestCanPost(t *testing.T) {
+	verifiedAt := time.Now()
+	tests := []struct {
+		name           string
+		requiredToPost bool
+		user           store.User
+		want           bool
+	}{
+		{
+			name: "anyone can post when verification is not required",
+			user: store.User{Username: "bob"},
+			want: true,
+		},
+		{
+			name:           "a user without an email can not post when it is required",
+			requiredToPost: true,
+			user:           store.User{Username: "bob"},
+		},
+		{
+			name:           "a user with an unverified email can not post when it is required",
+			requiredToPost: true,
+			user:           store.User{Username: "bob", Email: "bob@example.com"},
+		},
+		{
+			name:           "a user with a verified email can post when it is required",
+			requiredToPost: true,
+			user:           store.User{Username: "bob", Email: "bob@example.com", EmailVerifiedAt: &verifiedAt},
+			want:           true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApp(storetest.NewUserStore(), store.NewMemorySessionStore())
+			app.Config.EmailVerification.RequiredToPost = test.requiredToPost
+
+			if got := canPost(app, test.user); got != test.want {
+				t.Errorf("canPost = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/utils/responses"
+)
+
+var errHubNotRunning = errors.New("chat hub is not running")
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+type healthResponse struct {
+	Status string `json:"status"`
+	// Checks maps each readiness check to its result, ok or the reason it failed.
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// readinessCheck is one dependency the server needs to serve requests.
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// CreateHealthzHandler reports the process is alive. It checks nothing else, so a failing
+// dependency does not get a healthy process restarted.
+func CreateHealthzHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responses.WriteJSON(w, http.StatusOK, healthResponse{Status: statusOK})
+	}
+}
+
+// CreateReadyzHandler reports whether the server can serve requests: the database answers, its
+// schema is current and the chat hub is running. It responds 503 if any check fails or they take
+// longer than the health timeout.
+func CreateReadyzHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), app.Config.Server.HealthTimeout)
+		defer cancel()
+
+		response := healthResponse{Status: statusOK, Checks: make(map[string]string)}
+		for _, check := range readinessChecks(app) {
+			err := check.check(ctx)
+			if err != nil {
+				app.Logger.WarnContext(r.Context(), "Readiness check failed", "check", check.name, "err", err)
+				response.Status = statusUnavailable
+				response.Checks[check.name] = err.Error()
+				continue
+			}
+			response.Checks[check.name] = statusOK
+		}
+
+		status := http.StatusOK
+		if response.Status != statusOK {
+			status = http.StatusServiceUnavailable
+		}
+		responses.WriteJSON(w, status, response)
+	}
+}
+
+func readinessChecks(app *application.App) []readinessCheck {
+	var checks []readinessCheck
+	if app.DB != nil {
+		checks = append(checks, readinessCheck{name: "database", check: app.DB.Ping})
+	}
+	if app.Migrator != nil {
+		checks = append(checks, readinessCheck{name: "migrations", check: app.Migrator.CheckCurrent})
+	}
+	checks = append(checks, readinessCheck{name: "chat_hub", check: func(ctx context.Context) error {
+		if !app.Hub.Running() {
+			return errHubNotRunning
+		}
+		return nil
+	}})
+	return checks
+}
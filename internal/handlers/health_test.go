@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gochat/main/internal/chat"
+	"gochat/main/internal/store"
+	"gochat/main/internal/store/storetest"
+)
+
+func TestCreateHealthzHandler(t *testing.T) {
+	app := newTestApp(storetest.NewUserStore(), store.NewMemorySessionStore())
+
+	w := httptest.NewRecorder()
+	CreateHealthzHandler(app)(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestCreateReadyzHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		// hubState is how far the hub got, new, running or shut down.
+		hubState   string
+		wantStatus int
+		wantHub    string
+	}{
+		{
+			name:       "ready once the hub is running",
+			hubState:   "running",
+			wantStatus: http.StatusOK,
+			wantHub:    "ok",
+		},
+		{
+			name:       "unready before the hub starts",
+			hubState:   "new",
+			wantStatus: http.StatusServiceUnavailable,
+			wantHub:    errHubNotRunning.Error(),
+		},
+		{
+			name:       "unready once the hub shuts down",
+			hubState:   "shut down",
+			wantStatus: http.StatusServiceUnavailable,
+			wantHub:    errHubNotRunning.Error(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApp(storetest.NewUserStore(), store.NewMemorySessionStore())
+			app.Config.Server.HealthTimeout = time.Second
+			app.Hub = chat.NewHub(nil, nil)
+			if test.hubState != "new" {
+				go app.Hub.Run()
+				// Run marks the hub running as it starts, so wait for it.
+				for !app.Hub.Running() {
+					time.Sleep(time.Millisecond)
+				}
+			}
+			if test.hubState == "shut down" {
+				err := app.Hub.Shutdown(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			CreateReadyzHandler(app)(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			var response healthResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			if err != nil {
+				t.Fatalf("body %q is not JSON: %v", w.Body.String(), err)
+			}
+			if response.Checks["chat_hub"] != test.wantHub {
+				t.Errorf("chat_hub check = %q, want %q", response.Checks["chat_hub"], test.wantHub)
+			}
+		})
+	}
+}
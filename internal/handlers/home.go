@@ -1,15 +1,15 @@
 package handlers
 
 import (
-	"html/template"
 	"net/http"
 
+	"gochat/main/internal/application"
 	"gochat/main/internal/utils/responses"
 )
 
-func CreateHomeHandler(templates *template.Template) http.HandlerFunc {
+func CreateHomeHandler(app *application.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		responses.RenderTemplate(w, r, templates, "home.html", map[string]any{
+		responses.RenderTemplate(w, r, app.Templates, "home.html", map[string]any{
 			"user": nil,
 		})
 	}
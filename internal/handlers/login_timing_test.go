@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/ratelimit"
+	"gochat/main/internal/store"
+	"gochat/main/internal/store/storetest"
+	"gochat/main/internal/utils/passwords"
+)
+
+// loginTimingSamples is how many sign ins are timed for each case. Their median is compared, which
+// shrugs off the odd run slowed down by the scheduler or the garbage collector.
+const loginTimingSamples = 15
+
+// TestLoginTiming checks that signing in as someone who is not registered, or has been deactivated,
+// takes about as long as getting a registered user's password wrong. Otherwise the response time
+// tells an attacker which usernames are taken.
+func TestLoginTiming(t *testing.T) {
+	if testing.Short() {
+		t.Skip("times many sign ins")
+	}
+
+	// Cheaper than the defaults to keep the test quick, but still far slower than everything else
+	// on the login path, so skipping the hash stands out.
+	hashers, err := passwords.NewHashers(passwords.NewArgon2IdHasher(passwords.Argon2IdParams{
+		Time:    1,
+		Memory:  8 * 1024,
+		Threads: 1,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := storetest.NewUserStore()
+	users.Hashers = &hashers
+	users.AddUser("registered", "password123")
+	deactivated := users.AddUser("deactivated", "password123")
+	users.Deactivate(deactivated.ID)
+
+	app := newTestApp(users, store.NewMemorySessionStore())
+	// Every attempt has to reach the store, so nothing may be turned away by the limits.
+	rateLimits := ratelimit.NewMemoryStore()
+	app.LoginIPLimiter = ratelimit.NewLimiter(rateLimits, "login-ip", ratelimit.Limit{Burst: 1})
+	app.LoginUsernameLimiter = ratelimit.NewLimiter(rateLimits, "login-username", ratelimit.Limit{Burst: 1})
+
+	// The wrong password for a registered user is what the others are held up against.
+	usernames := []string{"registered", "nobody", "deactivated"}
+	durations := make(map[string][]time.Duration)
+	// Taking turns spreads any slow patch on the machine across every case.
+	for range loginTimingSamples {
+		for _, username := range usernames {
+			durations[username] = append(durations[username], timeLogin(t, app, username))
+		}
+	}
+
+	wrongPassword := median(durations["registered"])
+	for _, username := range usernames[1:] {
+		got := median(durations[username])
+		ratio := float64(got) / float64(wrongPassword)
+		if ratio < 0.5 || ratio > 2 {
+			t.Errorf("signing in as %q took %v, but a wrong password took %v", username, got, wrongPassword)
+		}
+	}
+}
+
+// timeLogin times one failed sign in as the user.
+func timeLogin(t *testing.T, app *application.App, username string) time.Duration {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r := newFormRequest(http.MethodPost, "/login", url.Values{"username": {username}, "password": {"wrong-password"}})
+
+	start := time.Now()
+	CreateLoginHandler(app)(w, r)
+	elapsed := time.Since(start)
+
+	if !strings.Contains(w.Body.String(), "We couldn't find a user with the given credentials.") {
+		t.Fatalf("signing in as %q was not turned away as invalid, status = %d", username, w.Code)
+	}
+	return elapsed
+}
+
+func median(durations []time.Duration) time.Duration {
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
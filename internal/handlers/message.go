@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/chat"
+	"gochat/main/internal/store"
+	"gochat/main/internal/utils/responses"
+)
+
+// CreateMessageHistoryHandler returns a page of a room's history as JSON to members of the room.
+// The page is selected with the before or after query parameters which take a message id.
+func CreateMessageHistoryHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			responses.WriteJSON(w, http.StatusUnauthorized, map[string]any{"error": "unauthorized"})
+			return
+		}
+
+		roomID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			responses.WriteJSON(w, http.StatusNotFound, map[string]any{"error": "room not found"})
+			return
+		}
+
+		room, err := app.Rooms.GetRoom(r.Context(), roomID, user.ID)
+		if err != nil {
+			if errors.Is(err, store.ErrRoomNotFound) {
+				responses.WriteJSON(w, http.StatusNotFound, map[string]any{"error": "room not found"})
+			} else {
+				app.Logger.ErrorContext(r.Context(), "Error getting room for history", "room_id", roomID, "err", err)
+				responses.WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "internal error"})
+			}
+			return
+		}
+
+		if !room.IsMember {
+			responses.WriteJSON(w, http.StatusForbidden, map[string]any{"error": "not a member of this room"})
+			return
+		}
+
+		page, err := parseMessagePage(r)
+		if err != nil {
+			responses.WriteJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+			return
+		}
+
+		storedMessages, err := app.Messages.GetMessages(r.Context(), room.ID, page)
+		if err != nil {
+			app.Logger.ErrorContext(r.Context(), "Error getting message history", "room_id", room.ID, "err", err)
+			responses.WriteJSON(w, http.StatusInternalServerError, map[string]any{"error": "internal error"})
+			return
+		}
+
+		messages := make([]chat.Message, 0, len(storedMessages))
+		for _, message := range storedMessages {
+			messages = append(messages, chat.NewMessage(message))
+		}
+
+		responses.WriteJSON(w, http.StatusOK, map[string]any{
+			"messages": messages,
+			// A full page means there may be more in the requested direction.
+			"hasMore": len(messages) == page.Limit,
+		})
+	}
+}
+
+func parseMessagePage(r *http.Request) (store.MessagePage, error) {
+	page := store.MessagePage{Limit: store.DefaultMessagePageLimit}
+	query := r.URL.Query()
+
+	if value := query.Get("before"); value != "" {
+		before, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || before <= 0 {
+			return store.MessagePage{}, errors.New("before must be a positive message id")
+		}
+		page.Before = before
+	}
+
+	if value := query.Get("after"); value != "" {
+		after, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || after <= 0 {
+			return store.MessagePage{}, errors.New("after must be a positive message id")
+		}
+		page.After = after
+	}
+
+	if page.Before > 0 && page.After > 0 {
+		return store.MessagePage{}, errors.New("before and after can not be used together")
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > store.MaxMessagePageLimit {
+			return store.MessagePage{}, fmt.Errorf("limit must be between 1 and %d", store.MaxMessagePageLimit)
+		}
+		page.Limit = limit
+	}
+
+	return page, nil
+}
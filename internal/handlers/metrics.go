@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"gochat/main/internal/application"
+)
+
+// CreateMetricsHandler serves the metrics to requests with the configured bearer token.
+func CreateMetricsHandler(app *application.App) http.HandlerFunc {
+	want := []byte("Bearer " + app.Config.Metrics.Token)
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Compared in constant time so the response time does not give the token away bit by bit.
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		app.Metrics.Registry.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gochat/main/internal/store"
+	"gochat/main/internal/store/storetest"
+)
+
+func TestMetricsRoute(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		wantStatus    int
+	}{
+		{
+			name:          "serves the metrics with the token",
+			token:         "scraper-token",
+			authorization: "Bearer scraper-token",
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:       "rejects a request without the token",
+			token:      "scraper-token",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "rejects the wrong token",
+			token:         "scraper-token",
+			authorization: "Bearer guess",
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "is not served without a token configured",
+			authorization: "Bearer ",
+			wantStatus:    http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApp(storetest.NewUserStore(), store.NewMemorySessionStore())
+			app.Config.Metrics.Token = test.token
+			mux := http.NewServeMux()
+			RegisterRoutes(mux, app)
+
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			if isServed := strings.Contains(w.Body.String(), "gochat_logins_total"); isServed != (test.wantStatus == http.StatusOK) {
+				t.Errorf("metrics served = %t, want %t", isServed, test.wantStatus == http.StatusOK)
+			}
+		})
+	}
+}
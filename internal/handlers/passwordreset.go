@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/forms"
+	"gochat/main/internal/mail"
+	"gochat/main/internal/store"
+	"gochat/main/internal/utils/responses"
+)
+
+// emailTokenLength is how many random bytes make up the token in a password reset or email
+// verification link.
+const emailTokenLength = 32
+
+func CreateForgotPasswordGetHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responses.RenderTemplate(w, r, app.Templates, "forgot-password.html", map[string]any{
+			"errors": forms.ValidationErrors{},
+			"form":   forms.ForgotPasswordForm{},
+		})
+	}
+}
+
+// CreateForgotPasswordHandler emails a password reset link to the user with the submitted email.
+// The response is the same whether or not anyone has the email, so it can not be used to find out
+// who has an account.
+func CreateForgotPasswordHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		forgotPasswordForm := forms.NewForgotPasswordFormFromRequest(r)
+
+		validationErrors := forgotPasswordForm.Validate()
+		if len(validationErrors) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			responses.RenderTemplate(w, r, app.Templates, "forgot-password.html", map[string]any{
+				"errors": validationErrors,
+				"form":   forgotPasswordForm,
+			})
+			return
+		}
+
+		err := sendPasswordReset(r, app, forgotPasswordForm.Email)
+		if err != nil {
+			responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "forgot-password.html", map[string]any{
+				"errors": forms.ValidationErrors{},
+				"form":   forgotPasswordForm,
+			})
+			app.Logger.ErrorContext(r.Context(), "Error sending password reset", "err", err)
+			return
+		}
+
+		responses.RenderTemplate(w, r, app.Templates, "forgot-password.html", map[string]any{
+			"errors": forms.ValidationErrors{},
+			"form":   forgotPasswordForm,
+			"isSent": true,
+		})
+	}
+}
+
+// CreateResetPasswordGetHandler shows the form for choosing a new password with the token from
+// the emailed link.
+func CreateResetPasswordGetHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The token is in the URL, which browsers would otherwise send on to any linked site.
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		responses.RenderTemplate(w, r, app.Templates, "reset-password.html", map[string]any{
+			"errors": forms.ValidationErrors{},
+			"form":   forms.ResetPasswordForm{Token: r.URL.Query().Get("token")},
+		})
+	}
+}
+
+// CreateResetPasswordHandler sets a new password with a reset token, signing the user out and
+// closing their chats everywhere since someone else may have known the old password.
+func CreateResetPasswordHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		resetPasswordForm := forms.NewResetPasswordFormFromRequest(r)
+
+		validationErrors := resetPasswordForm.Validate()
+		if len(validationErrors) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			responses.RenderTemplate(w, r, app.Templates, "reset-password.html", map[string]any{
+				"errors": validationErrors,
+				"form":   forms.ResetPasswordForm{Token: resetPasswordForm.Token},
+			})
+			return
+		}
+
+		userID, err := app.PasswordResets.ResetPassword(r.Context(), resetPasswordForm.Token, resetPasswordForm.Password)
+		if err != nil {
+			if errors.Is(err, store.ErrResetTokenInvalid) {
+				w.WriteHeader(http.StatusBadRequest)
+				responses.RenderTemplate(w, r, app.Templates, "reset-password.html", map[string]any{
+					"errors":         forms.ValidationErrors{},
+					"form":           forms.ResetPasswordForm{},
+					"isTokenInvalid": true,
+				})
+			} else {
+				responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "reset-password.html", map[string]any{
+					"errors": forms.ValidationErrors{},
+					"form":   forms.ResetPasswordForm{Token: resetPasswordForm.Token},
+				})
+				app.Logger.ErrorContext(r.Context(), "Error resetting password", "err", err)
+			}
+			return
+		}
+
+		// The password is reset whatever happens here, and the user can still revoke sessions
+		// themselves once signed in.
+		err = app.Sessions.DeleteUserSessions(r.Context(), userID)
+		if err != nil {
+			app.Logger.ErrorContext(r.Context(), "Error deleting sessions after resetting password", "err", err)
+		}
+		app.Hub.DisconnectUserEverywhere(userID)
+
+		http.Redirect(w, r, "/login?password-reset", http.StatusSeeOther)
+	}
+}
+
+// sendPasswordReset emails a reset link to the active user who has verified the email, if there is
+// one and the address has not already been sent too many. An unverified email could have been
+// mistyped or taken by someone else, who would then be able to take over the account.
+func sendPasswordReset(r *http.Request, app *application.App, email string) error {
+	// Emails are folded so changing case does not earn more of them.
+	result, err := app.PasswordResetLimiter.Allow(r.Context(), strings.ToLower(email), app.Clock.Now())
+	if err != nil {
+		return err
+	}
+	if !result.Allowed {
+		return nil
+	}
+
+	user, err := app.Users.GetUserByEmail(r.Context(), email)
+	if errors.Is(err, store.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := generateEmailToken()
+	if err != nil {
+		return err
+	}
+	err = app.PasswordResets.CreatePasswordResetToken(r.Context(), token, user.ID, app.Config.PasswordReset.TokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := strings.TrimSuffix(app.Config.Server.PublicURL, "/") + "/reset-password?" + url.Values{"token": {token}}.Encode()
+	message := mail.Message{
+		To:      user.Email,
+		Subject: "Reset your GoChat password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset the password of your GoChat account, %s. Follow this link within %s to choose a new one:\n\n"+
+			"%s\n\n"+
+			"If it wasn't you, ignore this email and your password will stay the same.\n",
+			user.Name(), user.Username, formatRetryAfter(int(app.Config.PasswordReset.TokenTTL.Seconds())), link),
+	}
+
+	// Sent in the background, so a slow mail server does not make the response give away that
+	// someone has the email.
+	app.SendEmailInBackground(r.Context(), message)
+	return nil
+}
+
+func generateEmailToken() (string, error) {
+	bytes := make([]byte, emailTokenLength)
+
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", err
+	}
+
+	// URL safe, since it goes in the emailed link.
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/chat"
+	"gochat/main/internal/mail"
+	"gochat/main/internal/models"
+	"gochat/main/internal/store"
+	"gochat/main/internal/store/storetest"
+)
+
+// recordingMailer hands every message it is sent to the test.
+type recordingMailer struct {
+	messages chan mail.Message
+}
+
+func (mailer recordingMailer) Send(ctx context.Context, message mail.Message) error {
+	mailer.messages <- message
+	return nil
+}
+
+// resetLinkPattern finds the reset link in an email.
+var resetLinkPattern = regexp.MustCompile(`http://localhost:8080/reset-password\?token=[A-Za-z0-9_-]+`)
+
+// newPasswordResetTestApp returns an app with bob, who has verified his email, and a mailer to read
+// his mail.
+func newPasswordResetTestApp(t *testing.T) (*application.App, store.User, chan mail.Message) {
+	t.Helper()
+
+	userStore := storetest.NewUserStore()
+	bob := userStore.AddUser("bob", "password123")
+	bob, err := userStore.UpdateEmail(context.Background(), bob.ID, "Bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob = userStore.MarkEmailVerified(bob.ID)
+
+	app := newTestApp(userStore, store.NewMemorySessionStore())
+	app.PasswordResets = storetest.NewPasswordResetStore(userStore)
+	messages := make(chan mail.Message, 10)
+	app.Mailer = recordingMailer{messages: messages}
+	app.Hub = chat.NewHub(nil, nil)
+	go app.Hub.Run()
+	return app, bob, messages
+}
+
+// requestResetLink asks for a reset link for bob and returns the token from the email.
+func requestResetLink(t *testing.T, app *application.App, messages chan mail.Message) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	CreateForgotPasswordHandler(app)(w, newFormRequest(http.MethodPost, "/forgot-password", url.Values{"email": {"bob@example.com"}}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	select {
+	case message := <-messages:
+		link := resetLinkPattern.FindString(message.Body)
+		if link == "" {
+			t.Fatalf("no reset link in %q", message.Body)
+		}
+		parsed, err := url.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Query().Get("token")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email sent")
+		return ""
+	}
+}
+
+func TestCreateForgotPasswordHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		email      string
+		unverified bool
+		wantStatus int
+		wantBody   string
+		wantEmail  bool
+	}{
+		{
+			name:       "emails a user a reset link",
+			email:      "bob@example.com",
+			wantStatus: http.StatusOK,
+			wantBody:   "If an account has that email",
+			wantEmail:  true,
+		},
+		{
+			name:       "answers the same for an unknown email",
+			email:      "alice@example.com",
+			wantStatus: http.StatusOK,
+			wantBody:   "If an account has that email",
+		},
+		{
+			name:       "answers the same for an unverified email",
+			email:      "bob@example.com",
+			unverified: true,
+			wantStatus: http.StatusOK,
+			wantBody:   "If an account has that email",
+		},
+		{
+			name:       "rejects an invalid email",
+			email:      "bob",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Email is not a valid email address.",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app, bob, messages := newPasswordResetTestApp(t)
+			if test.unverified {
+				// Changing the email, even back to the same one after another, clears its verification.
+				users := app.Users.(*storetest.UserStore)
+				_, err := users.UpdateEmail(context.Background(), bob.ID, "robert@example.com")
+				if err != nil {
+					t.Fatal(err)
+				}
+				bob, err = users.UpdateEmail(context.Background(), bob.ID, "bob@example.com")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			CreateForgotPasswordHandler(app)(w, newFormRequest(http.MethodPost, "/forgot-password", url.Values{"email": {test.email}}))
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), test.wantBody) {
+				t.Errorf("body does not contain %q", test.wantBody)
+			}
+
+			if !test.wantEmail {
+				// Emails go out in the background, but the token is stored before responding.
+				if tokens := app.PasswordResets.(*storetest.PasswordResetStore).Tokens(); tokens != 0 {
+					t.Errorf("stored %d tokens, want none", tokens)
+				}
+				return
+			}
+			select {
+			case message := <-messages:
+				if message.To != bob.Email {
+					t.Errorf("email sent to %q, want %q", message.To, bob.Email)
+				}
+				if !resetLinkPattern.MatchString(message.Body) {
+					t.Errorf("no reset link in %q", message.Body)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no email sent")
+			}
+		})
+	}
+}
+
+func TestCreateForgotPasswordHandlerLimitsEmails(t *testing.T) {
+	app, _, messages := newPasswordResetTestApp(t)
+
+	burst := app.Config.PasswordReset.EmailBurst
+	for range burst + 2 {
+		w := httptest.NewRecorder()
+		CreateForgotPasswordHandler(app)(w, newFormRequest(http.MethodPost, "/forgot-password", url.Values{"email": {"BOB@example.com"}}))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+	}
+
+	if tokens := app.PasswordResets.(*storetest.PasswordResetStore).Tokens(); tokens != burst {
+		t.Errorf("stored %d tokens, want %d", tokens, burst)
+	}
+	for range burst {
+		<-messages
+	}
+}
+
+func TestCreateResetPasswordHandler(t *testing.T) {
+	app, bob, messages := newPasswordResetTestApp(t)
+	token := requestResetLink(t, app, messages)
+	conn := connectChat(t, app, bob)
+
+	sessionID := "session-id"
+	_, err := app.Sessions.CreateSession(context.Background(), sessionID, bob.ID, time.Now().Add(time.Hour), models.SessionMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mismatched := url.Values{"token": {token}, "password": {"new-password"}, "confirm-password": {"other-password"}}
+	w := httptest.NewRecorder()
+	CreateResetPasswordHandler(app)(w, newFormRequest(http.MethodPost, "/reset-password", mismatched))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Passwords do not match.") {
+		t.Errorf("mismatched passwords response = %d, want %d saying they do not match", w.Code, http.StatusBadRequest)
+	}
+
+	form := url.Values{"token": {token}, "password": {"new-password"}, "confirm-password": {"new-password"}}
+	w = httptest.NewRecorder()
+	CreateResetPasswordHandler(app)(w, newFormRequest(http.MethodPost, "/reset-password", form))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login?password-reset" {
+		t.Fatalf("response = %d %q, want a redirect to /login?password-reset", w.Code, w.Header().Get("Location"))
+	}
+
+	_, err = app.Users.AuthenticateUser(context.Background(), "bob", "new-password")
+	if err != nil {
+		t.Errorf("signing in with the new password: %v", err)
+	}
+	_, err = app.Sessions.GetSession(context.Background(), sessionID)
+	if !errors.Is(err, store.ErrSessionNotFound) {
+		t.Errorf("old session still exists, err = %v", err)
+	}
+	if !waitForClose(t, conn) {
+		t.Error("chat connection was not closed")
+	}
+
+	// The token only works once.
+	form.Set("password", "another-password")
+	form.Set("confirm-password", "another-password")
+	w = httptest.NewRecorder()
+	CreateResetPasswordHandler(app)(w, newFormRequest(http.MethodPost, "/reset-password", form))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "This reset link is invalid or has expired.") {
+		t.Errorf("reused token response = %d, want %d saying the link is invalid", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCreateResetPasswordHandlerRejectsExpiredToken(t *testing.T) {
+	app, _, messages := newPasswordResetTestApp(t)
+	app.Config.PasswordReset.TokenTTL = time.Nanosecond
+	token := requestResetLink(t, app, messages)
+
+	form := url.Values{"token": {token}, "password": {"new-password"}, "confirm-password": {"new-password"}}
+	w := httptest.NewRecorder()
+	CreateResetPasswordHandler(app)(w, newFormRequest(http.MethodPost, "/reset-password", form))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	_, err := app.Users.AuthenticateUser(context.Background(), "bob", "password123")
+	if err != nil {
+		t.Errorf("signing in with the old password: %v", err)
+	}
+}
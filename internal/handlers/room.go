@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/chat"
+	"gochat/main/internal/forms"
+	"gochat/main/internal/store"
+	"gochat/main/internal/utils/responses"
+)
+
+func CreateRoomsHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		rooms, err := app.Rooms.ListRooms(r.Context(), user.ID)
+		if err != nil {
+			app.Logger.ErrorContext(r.Context(), "Error listing rooms", "err", err)
+			responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "rooms.html", map[string]any{
+				"errors": map[string]string{},
+				"form":   forms.RoomForm{},
+			})
+			return
+		}
+
+		responses.RenderTemplate(w, r, app.Templates, "rooms.html", map[string]any{
+			"errors": map[string]string{},
+			"form":   forms.RoomForm{},
+			"rooms":  rooms,
+		})
+	}
+}
+
+func CreateRoomCreateHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		roomForm := forms.NewRoomFormFromRequest(r)
+
+		renderWithErrors := func(validationErrors forms.ValidationErrors) {
+			rooms, err := app.Rooms.ListRooms(r.Context(), user.ID)
+			if err != nil {
+				app.Logger.ErrorContext(r.Context(), "Error listing rooms", "err", err)
+			}
+
+			w.WriteHeader(http.StatusBadRequest)
+			responses.RenderTemplate(w, r, app.Templates, "rooms.html", map[string]any{
+				"errors": validationErrors,
+				"form":   roomForm,
+				"rooms":  rooms,
+			})
+		}
+
+		validationErrors := roomForm.Validate()
+		if len(validationErrors) > 0 {
+			renderWithErrors(validationErrors)
+			return
+		}
+
+		room, err := app.Rooms.CreateRoom(r.Context(), roomForm.Name, user.ID)
+		if err != nil {
+			if errors.Is(err, store.ErrRoomNameTaken) {
+				renderWithErrors(forms.ValidationErrors{
+					"Name": "A room with this name already exists.",
+				})
+			} else {
+				app.Logger.ErrorContext(r.Context(), "Error creating room", "err", err)
+				responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "rooms.html", map[string]any{
+					"errors": map[string]string{},
+					"form":   roomForm,
+				})
+			}
+			return
+		}
+
+		http.Redirect(w, r, roomURL(room.ID), http.StatusSeeOther)
+	}
+}
+
+func CreateRoomHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		room, ok := getRoomFromPath(w, r, app, user)
+		if !ok {
+			return
+		}
+
+		var members []store.RoomMember
+		if room.IsMember {
+			var err error
+			members, err = app.Rooms.GetRoomMembers(r.Context(), room.ID)
+			if err != nil {
+				app.Logger.ErrorContext(r.Context(), "Error getting room members", "room_id", room.ID, "err", err)
+				responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "room.html", map[string]any{
+					"room": room,
+				})
+				return
+			}
+		}
+
+		responses.RenderTemplate(w, r, app.Templates, "room.html", map[string]any{
+			"room":             room,
+			"members":          members,
+			"isOwner":          room.IsOwnedBy(user.ID),
+			"canPost":          canPost(app, user),
+			"maxMessageLength": chat.MaxMessageLength,
+		})
+	}
+}
+
+func CreateJoinRoomHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		roomID, ok := parseRoomID(w, r)
+		if !ok {
+			return
+		}
+
+		err := app.Rooms.JoinRoom(r.Context(), roomID, user.ID)
+		if err != nil {
+			writeRoomError(w, r, app, roomID, err)
+			return
+		}
+
+		http.Redirect(w, r, roomURL(roomID), http.StatusSeeOther)
+	}
+}
+
+func CreateLeaveRoomHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		roomID, ok := parseRoomID(w, r)
+		if !ok {
+			return
+		}
+
+		err := app.Rooms.LeaveRoom(r.Context(), roomID, user.ID)
+		if err != nil && !errors.Is(err, store.ErrNotRoomMember) {
+			writeRoomError(w, r, app, roomID, err)
+			return
+		}
+
+		app.Hub.DisconnectUser(roomID, user.ID)
+		http.Redirect(w, r, "/rooms", http.StatusSeeOther)
+	}
+}
+
+func CreateArchiveRoomHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		roomID, ok := parseRoomID(w, r)
+		if !ok {
+			return
+		}
+
+		err := app.Rooms.ArchiveRoom(r.Context(), roomID, user.ID)
+		if err != nil {
+			writeRoomError(w, r, app, roomID, err)
+			return
+		}
+
+		app.Hub.DisconnectRoom(roomID)
+		http.Redirect(w, r, roomURL(roomID), http.StatusSeeOther)
+	}
+}
+
+func roomURL(roomID int64) string {
+	return fmt.Sprintf("/rooms/%d", roomID)
+}
+
+func parseRoomID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	roomID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return 0, false
+	}
+	return roomID, true
+}
+
+// getRoomFromPath loads the room named by the id path value, writing an error response if it can't.
+func getRoomFromPath(w http.ResponseWriter, r *http.Request, app *application.App, user store.User) (store.Room, bool) {
+	roomID, ok := parseRoomID(w, r)
+	if !ok {
+		return store.Room{}, false
+	}
+
+	room, err := app.Rooms.GetRoom(r.Context(), roomID, user.ID)
+	if err != nil {
+		writeRoomError(w, r, app, roomID, err)
+		return store.Room{}, false
+	}
+	return room, true
+}
+
+func writeRoomError(w http.ResponseWriter, r *http.Request, app *application.App, roomID int64, err error) {
+	switch {
+	case errors.Is(err, store.ErrRoomNotFound):
+		http.NotFound(w, r)
+	case errors.Is(err, store.ErrNotRoomOwner):
+		http.Error(w, "Only the creator of a room can archive it.", http.StatusForbidden)
+	case errors.Is(err, store.ErrRoomArchived):
+		http.Error(w, "This room has been archived.", http.StatusConflict)
+	default:
+		app.Logger.ErrorContext(r.Context(), "Error handling room", "room_id", roomID, "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gochat/main/internal/application"
+)
+
+// RegisterRoutes adds every route to the mux.
+func RegisterRoutes(mux *http.ServeMux, app *application.App) {
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
+	mux.HandleFunc("GET /{$}", CreateHomeHandler(app))
+
+	addUserRoutes(mux, app)
+	addSessionRoutes(mux, app)
+	addSettingsRoutes(mux, app)
+	addRoomRoutes(mux, app)
+	addDirectMessageRoutes(mux, app)
+	mux.HandleFunc("GET /ws", CreateWebSocketHandler(app))
+	// Only scrapers given the token can read the metrics, and nobody can without one.
+	if app.Config.Metrics.Token != "" {
+		mux.HandleFunc("GET /metrics", CreateMetricsHandler(app))
+	}
+	mux.HandleFunc("GET /healthz", CreateHealthzHandler(app))
+	mux.HandleFunc("GET /readyz", CreateReadyzHandler(app))
+}
+
+func addUserRoutes(mux *http.ServeMux, app *application.App) {
+	mux.HandleFunc("GET /login", CreateLoginGetHandler(app))
+	mux.HandleFunc("POST /login", CreateLoginHandler(app))
+	mux.HandleFunc("GET /logout", CreateLogoutHandler(app))
+	mux.HandleFunc("GET /signup", CreateSignUpGetHandler(app))
+	mux.HandleFunc("POST /signup", CreateUserHandler(app))
+	mux.HandleFunc("GET /forgot-password", CreateForgotPasswordGetHandler(app))
+	mux.HandleFunc("POST /forgot-password", CreateForgotPasswordHandler(app))
+	mux.HandleFunc("GET /reset-password", CreateResetPasswordGetHandler(app))
+	mux.HandleFunc("POST /reset-password", CreateResetPasswordHandler(app))
+	mux.HandleFunc("GET /verify-email", CreateVerifyEmailGetHandler(app))
+	mux.HandleFunc("POST /verify-email", CreateVerifyEmailHandler(app))
+}
+
+func addSessionRoutes(mux *http.ServeMux, app *application.App) {
+	mux.HandleFunc("GET /sessions", CreateSessionsHandler(app))
+	mux.HandleFunc("POST /sessions/{hash}/revoke", CreateRevokeSessionHandler(app))
+	mux.HandleFunc("POST /sessions/revoke-others", CreateRevokeOtherSessionsHandler(app))
+}
+
+func addSettingsRoutes(mux *http.ServeMux, app *application.App) {
+	mux.HandleFunc("GET /settings", CreateSettingsHandler(app))
+	mux.HandleFunc("POST /settings/password", CreateChangePasswordHandler(app))
+	mux.HandleFunc("POST /settings/display-name", CreateChangeDisplayNameHandler(app))
+	mux.HandleFunc("POST /settings/email", CreateChangeEmailHandler(app))
+	mux.HandleFunc("POST /settings/email/verify", CreateResendVerificationHandler(app))
+	mux.HandleFunc("POST /settings/deactivate", CreateDeactivateAccountHandler(app))
+}
+
+func addRoomRoutes(mux *http.ServeMux, app *application.App) {
+	mux.HandleFunc("GET /rooms", CreateRoomsHandler(app))
+	mux.HandleFunc("POST /rooms", CreateRoomCreateHandler(app))
+	mux.HandleFunc("GET /rooms/{id}", CreateRoomHandler(app))
+	mux.HandleFunc("GET /rooms/{id}/messages", CreateMessageHistoryHandler(app))
+	mux.HandleFunc("POST /rooms/{id}/join", CreateJoinRoomHandler(app))
+	mux.HandleFunc("POST /rooms/{id}/leave", CreateLeaveRoomHandler(app))
+	mux.HandleFunc("POST /rooms/{id}/archive", CreateArchiveRoomHandler(app))
+}
+
+func addDirectMessageRoutes(mux *http.ServeMux, app *application.App) {
+	mux.HandleFunc("GET /dm", CreateConversationsHandler(app))
+	mux.HandleFunc("POST /dm", CreateStartConversationHandler(app))
+	mux.HandleFunc("GET /dm/{id}", CreateConversationHandler(app))
+	mux.HandleFunc("GET /dm/{id}/messages", CreateDirectMessageHistoryHandler(app))
+	mux.HandleFunc("POST /dm/{id}/read", CreateMarkConversationReadHandler(app))
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/models"
+	"gochat/main/internal/store"
+	"gochat/main/internal/utils/responses"
+	"gochat/main/internal/utils/sessions"
+)
+
+// CreateSessionsHandler lists the current user's active sessions.
+func CreateSessionsHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		currentSession, _ := currentSession(r)
+
+		userSessions, err := app.Sessions.ListUserSessions(r.Context(), user.ID)
+		if err != nil {
+			app.Logger.ErrorContext(r.Context(), "Error listing sessions", "err", err)
+			responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "sessions.html", map[string]any{})
+			return
+		}
+
+		responses.RenderTemplate(w, r, app.Templates, "sessions.html", map[string]any{
+			"sessions":             userSessions,
+			"currentSessionIDHash": currentSession.SessionIDHash,
+		})
+	}
+}
+
+// CreateRevokeSessionHandler deletes one of the current user's sessions.
+// Revoking the session making the request logs the user out.
+func CreateRevokeSessionHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		currentSession, _ := currentSession(r)
+
+		sessionIDHash := r.PathValue("hash")
+		err := app.Sessions.DeleteUserSession(r.Context(), user.ID, sessionIDHash)
+		if err != nil && !errors.Is(err, store.ErrSessionNotFound) {
+			app.Logger.ErrorContext(r.Context(), "Error revoking session", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if sessionIDHash == currentSession.SessionIDHash {
+			clearSessionCookie := sessions.CreateClearSessionCookie()
+			http.SetCookie(w, &clearSessionCookie)
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		http.Redirect(w, r, "/sessions", http.StatusSeeOther)
+	}
+}
+
+// CreateRevokeOtherSessionsHandler signs the current user out everywhere except the current session.
+func CreateRevokeOtherSessionsHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		sessionCookie, err := r.Cookie(sessions.CookieName())
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		err = app.Sessions.DeleteUserSessionsExcept(r.Context(), user.ID, sessionCookie.Value)
+		if err != nil {
+			app.Logger.ErrorContext(r.Context(), "Error revoking other sessions", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/sessions", http.StatusSeeOther)
+	}
+}
+
+// rotateSession issues the user a brand new session, deleting the one the request came with if any.
+// It should be called whenever the user's privileges change, such as signing in or changing their
+// password, so that a session id known to an attacker beforehand is worthless afterwards.
+func rotateSession(w http.ResponseWriter, r *http.Request, app *application.App, userID int64) error {
+	oldSessionCookie, err := r.Cookie(sessions.CookieName())
+	if err == nil {
+		err = app.Sessions.DeleteSession(r.Context(), oldSessionCookie.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	now := app.Clock.Now()
+	sessionCookie, err := sessions.CreateSessionCookie(app.SessionPolicy.ExpiresAt(now, now))
+	if err != nil {
+		return err
+	}
+
+	metadata := models.SessionMetadata{
+		UserAgent: r.UserAgent(),
+		IPAddress: app.TrustedProxies.ClientIP(r),
+	}
+	_, err = app.Sessions.CreateSession(r.Context(), sessionCookie.Value, userID, sessionCookie.Expires, metadata)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &sessionCookie)
+	return nil
+}
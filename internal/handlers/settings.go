@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/forms"
+	"gochat/main/internal/store"
+	"gochat/main/internal/utils/responses"
+	"gochat/main/internal/utils/sessions"
+)
+
+// CreateSettingsHandler shows the forms for changing the current user's account.
+func CreateSettingsHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		responses.RenderTemplate(w, r, app.Templates, "settings.html", settingsData(app, user, map[string]any{
+			// Set by the redirect after a change, so the page can confirm it.
+			"updated": r.URL.Query().Get("updated"),
+		}))
+	}
+}
+
+// CreateChangePasswordHandler changes the current user's password. Every session the user has is
+// signed out, since one may belong to whoever knew the old password, and this browser is given a
+// new one.
+func CreateChangePasswordHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		changePasswordForm := forms.NewChangePasswordFormFromRequest(r)
+
+		validationErrors := changePasswordForm.Validate()
+		if len(validationErrors) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			responses.RenderTemplate(w, r, app.Templates, "settings.html", settingsData(app, user, map[string]any{
+				"passwordErrors": validationErrors,
+			}))
+			return
+		}
+
+		err := app.Users.ChangePassword(r.Context(), user.ID, changePasswordForm.CurrentPassword, changePasswordForm.Password)
+		if err != nil {
+			if errors.Is(err, store.ErrInvalidCredentials) {
+				w.WriteHeader(http.StatusBadRequest)
+				responses.RenderTemplate(w, r, app.Templates, "settings.html", settingsData(app, user, map[string]any{
+					"passwordErrors": forms.ValidationErrors{
+						"CurrentPassword": "Current password is incorrect.",
+					},
+				}))
+			} else {
+				responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "settings.html", settingsData(app, user, map[string]any{}))
+				app.Logger.ErrorContext(r.Context(), "Error changing password", "err", err)
+			}
+			return
+		}
+
+		err = app.Sessions.DeleteUserSessions(r.Context(), user.ID)
+		if err != nil {
+			responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "settings.html", settingsData(app, user, map[string]any{}))
+			app.Logger.ErrorContext(r.Context(), "Error deleting sessions after changing password", "err", err)
+			return
+		}
+		// The new session does not exist yet, so this only closes the chats of the deleted ones.
+		app.Hub.DisconnectUserEverywhere(user.ID)
+
+		err = rotateSession(w, r, app, user.ID)
+		if err != nil {
+			// Every session is already gone, so the user has to sign in again with the new password.
+			app.Logger.ErrorContext(r.Context(), "Error rotating session", "err", err)
+			clearSessionCookie := sessions.CreateClearSessionCookie()
+			http.SetCookie(w, &clearSessionCookie)
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		http.Redirect(w, r, "/settings?updated=password", http.StatusSeeOther)
+	}
+}
+
+// CreateChangeDisplayNameHandler changes the name the current user is shown as.
+func CreateChangeDisplayNameHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		displayNameForm := forms.NewDisplayNameFormFromRequest(r)
+
+		validationErrors := displayNameForm.Validate()
+		if len(validationErrors) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			responses.RenderTemplate(w, r, app.Templates, "settings.html", settingsData(app, user, map[string]any{
+				"displayNameForm":   displayNameForm,
+				"displayNameErrors": validationErrors,
+			}))
+			return
+		}
+
+		_, err := app.Users.UpdateDisplayName(r.Context(), user.ID, displayNameForm.DisplayName)
+		if err != nil {
+			responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "settings.html", settingsData(app, user, map[string]any{
+				"displayNameForm": displayNameForm,
+			}))
+			app.Logger.ErrorContext(r.Context(), "Error changing display name", "err", err)
+			return
+		}
+
+		http.Redirect(w, r, "/settings?updated=display-name", http.StatusSeeOther)
+	}
+}
+
+// CreateChangeEmailHandler changes the email password reset links are sent to, emailing a link to
+// verify it when it is new.
+func CreateChangeEmailHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		emailForm := forms.NewEmailFormFromRequest(r)
+
+		validationErrors := emailForm.Validate()
+		if len(validationErrors) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			responses.RenderTemplate(w, r, app.Templates, "settings.html", settingsData(app, user, map[string]any{
+				"emailForm":   emailForm,
+				"emailErrors": validationErrors,
+			}))
+			return
+		}
+
+		updatedUser, err := app.Users.UpdateEmail(r.Context(), user.ID, emailForm.Email)
+		if err != nil {
+			responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "settings.html", settingsData(app, user, map[string]any{
+				"emailForm": emailForm,
+			}))
+			app.Logger.ErrorContext(r.Context(), "Error changing email", "err", err)
+			return
+		}
+
+		// Chats decide whether the user can post when they connect, so they are closed to reconnect
+		// under the new email.
+		if canPost(app, user) != canPost(app, updatedUser) {
+			app.Hub.DisconnectUserEverywhere(user.ID)
+		}
+
+		if updatedUser.Email != "" && !updatedUser.IsEmailVerified() {
+			// The email is changed either way, and another link can be sent from the settings page.
+			err = sendEmailVerification(r, app, updatedUser)
+			if err != nil {
+				app.Logger.ErrorContext(r.Context(), "Error sending email verification", "err", err)
+			}
+		}
+
+		http.Redirect(w, r, "/settings?updated=email", http.StatusSeeOther)
+	}
+}
+
+// CreateDeactivateAccountHandler deactivates the current user once they confirm their password,
+// signing them out everywhere.
+func CreateDeactivateAccountHandler(app *application.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		deactivateForm := forms.NewDeactivateAccountFormFromRequest(r)
+
+		validationErrors := deactivateForm.Validate()
+		if len(validationErrors) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			responses.RenderTemplate(w, r, app.Templates, "settings.html", settingsData(app, user, map[string]any{
+				"deactivateErrors": validationErrors,
+			}))
+			return
+		}
+
+		err := app.Users.DeactivateUser(r.Context(), user.ID, deactivateForm.Password)
+		if err != nil {
+			if errors.Is(err, store.ErrInvalidCredentials) {
+				w.WriteHeader(http.StatusBadRequest)
+				responses.RenderTemplate(w, r, app.Templates, "settings.html", settingsData(app, user, map[string]any{
+					"deactivateErrors": forms.ValidationErrors{
+						"Password": "Password is incorrect.",
+					},
+				}))
+			} else {
+				responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "settings.html", settingsData(app, user, map[string]any{}))
+				app.Logger.ErrorContext(r.Context(), "Error deactivating user", "err", err)
+			}
+			return
+		}
+
+		// Sessions of inactive users are already turned away, so failing to delete them is only untidy.
+		err = app.Sessions.DeleteUserSessions(r.Context(), user.ID)
+		if err != nil {
+			app.Logger.ErrorContext(r.Context(), "Error deleting sessions after deactivating user", "err", err)
+		}
+		app.Hub.DisconnectUserEverywhere(user.ID)
+
+		clearSessionCookie := sessions.CreateClearSessionCookie()
+		http.SetCookie(w, &clearSessionCookie)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// settingsData fills in whatever the settings page needs that data leaves out, since every form
+// on it is rendered whichever one was submitted.
+func settingsData(app *application.App, user store.User, data map[string]any) map[string]any {
+	defaults := map[string]any{
+		"canPost":           canPost(app, user),
+		"displayNameForm":   forms.DisplayNameForm{DisplayName: user.DisplayName},
+		"emailForm":         forms.EmailForm{Email: user.Email},
+		"passwordErrors":    forms.ValidationErrors{},
+		"displayNameErrors": forms.ValidationErrors{},
+		"emailErrors":       forms.ValidationErrors{},
+		"deactivateErrors":  forms.ValidationErrors{},
+	}
+	for key, value := range defaults {
+		if _, ok := data[key]; !ok {
+			data[key] = value
+		}
+	}
+	return data
+}
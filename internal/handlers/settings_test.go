@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/chat"
+	"gochat/main/internal/models"
+	"gochat/main/internal/store"
+	"gochat/main/internal/store/storetest"
+	"gochat/main/internal/utils/sessions"
+
+	"github.com/gorilla/websocket"
+)
+
+// signIn gives the user a session and attaches both to the request like AuthMiddleware does.
+func signIn(t *testing.T, r *http.Request, sessionStore store.SessionStore, user store.User, sessionID string) *http.Request {
+	t.Helper()
+
+	session, err := sessionStore.CreateSession(context.Background(), sessionID, user.ID, time.Now().Add(time.Hour), models.SessionMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.AddCookie(&http.Cookie{Name: sessions.CookieName(), Value: sessionID})
+	ctx := context.WithValue(r.Context(), sessions.UserContextKey, user)
+	ctx = context.WithValue(ctx, sessions.SessionContextKey, session)
+	return r.WithContext(ctx)
+}
+
+// connectChat opens a chat connection as the user, which the test closes when it finishes.
+func connectChat(t *testing.T, app *application.App, user store.User) *websocket.Conn {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chat.ServeWebSocket(app.Hub, user, 1, true, w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	clients := app.Hub.Stats().Clients
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	// The handler returns before the hub has registered the client.
+	for app.Hub.Stats().Clients == clients {
+		time.Sleep(time.Millisecond)
+	}
+	return conn
+}
+
+// waitForClose reports whether the server closes the chat connection.
+func waitForClose(t *testing.T, conn *websocket.Conn) bool {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			return errors.As(err, &closeErr)
+		}
+	}
+}
+
+func TestCreateSettingsHandler(t *testing.T) {
+	userStore := storetest.NewUserStore()
+	bob := userStore.AddUser("bob", "password123")
+	bob, err := userStore.UpdateDisplayName(context.Background(), bob.ID, "Bobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionStore := store.NewMemorySessionStore()
+	app := newTestApp(userStore, sessionStore)
+
+	w := httptest.NewRecorder()
+	CreateSettingsHandler(app)(w, httptest.NewRequest(http.MethodGet, "/settings", nil))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login" {
+		t.Errorf("signed out response = %d %q, want a redirect to /login", w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	r := signIn(t, httptest.NewRequest(http.MethodGet, "/settings?updated=display-name", nil), sessionStore, bob, "session-id")
+	CreateSettingsHandler(app)(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	for _, want := range []string{`value="Bobby"`, "Your display name has been changed."} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("body does not contain %q", want)
+		}
+	}
+}
+
+func TestCreateChangePasswordHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		form         url.Values
+		wantStatus   int
+		wantBody     string
+		wantPassword string
+	}{
+		{
+			name:         "changes the password",
+			form:         url.Values{"current-password": {"password123"}, "password": {"new-password"}, "confirm-password": {"new-password"}},
+			wantStatus:   http.StatusSeeOther,
+			wantPassword: "new-password",
+		},
+		{
+			name:         "rejects a wrong current password",
+			form:         url.Values{"current-password": {"wrong-password"}, "password": {"new-password"}, "confirm-password": {"new-password"}},
+			wantStatus:   http.StatusBadRequest,
+			wantBody:     "Current password is incorrect.",
+			wantPassword: "password123",
+		},
+		{
+			name:         "rejects mismatched passwords",
+			form:         url.Values{"current-password": {"password123"}, "password": {"new-password"}, "confirm-password": {"other-password"}},
+			wantStatus:   http.StatusBadRequest,
+			wantBody:     "Passwords do not match.",
+			wantPassword: "password123",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userStore := storetest.NewUserStore()
+			bob := userStore.AddUser("bob", "password123")
+			sessionStore := store.NewMemorySessionStore()
+
+			// Another browser signed in as bob, which changing the password should sign out.
+			otherSessionID := "other-session-id"
+			_, err := sessionStore.CreateSession(context.Background(), otherSessionID, bob.ID, time.Now().Add(time.Hour), models.SessionMetadata{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			app := newTestApp(userStore, sessionStore)
+			app.Hub = chat.NewHub(nil, nil)
+			go app.Hub.Run()
+			conn := connectChat(t, app, bob)
+
+			sessionID := "session-id"
+			r := signIn(t, newFormRequest(http.MethodPost, "/settings/password", test.form), sessionStore, bob, sessionID)
+			w := httptest.NewRecorder()
+			CreateChangePasswordHandler(app)(w, r)
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), test.wantBody) {
+				t.Errorf("body does not contain %q", test.wantBody)
+			}
+			_, err = userStore.AuthenticateUser(context.Background(), "bob", test.wantPassword)
+			if err != nil {
+				t.Errorf("signing in with %q: %v", test.wantPassword, err)
+			}
+
+			changed := test.wantStatus == http.StatusSeeOther
+			if closed := waitForClose(t, conn); closed != changed {
+				t.Errorf("chat connection closed = %t, want %t", closed, changed)
+			}
+			for _, oldSessionID := range []string{sessionID, otherSessionID} {
+				_, err = sessionStore.GetSession(context.Background(), oldSessionID)
+				deleted := errors.Is(err, store.ErrSessionNotFound)
+				if deleted != changed {
+					t.Errorf("session %q deleted = %t, want %t", oldSessionID, deleted, changed)
+				}
+			}
+
+			cookie, ok := findCookie(w.Result())
+			if ok != changed {
+				t.Fatalf("cookie set = %t, want %t", ok, changed)
+			}
+			if ok {
+				_, err = sessionStore.GetSession(context.Background(), cookie.Value)
+				if err != nil {
+					t.Errorf("new session: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateChangeDisplayNameHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		displayName     string
+		wantStatus      int
+		wantBody        string
+		wantDisplayName string
+		wantName        string
+	}{
+		{
+			name:            "changes the display name",
+			displayName:     "  Bobby  ",
+			wantStatus:      http.StatusSeeOther,
+			wantDisplayName: "Bobby",
+			wantName:        "Bobby",
+		},
+		{
+			name:            "clears the display name",
+			displayName:     "",
+			wantStatus:      http.StatusSeeOther,
+			wantDisplayName: "",
+			wantName:        "bob",
+		},
+		{
+			name:            "rejects a long display name",
+			displayName:     strings.Repeat("b", 51),
+			wantStatus:      http.StatusBadRequest,
+			wantBody:        "Display name can not be greater than 50 characters.",
+			wantDisplayName: "Bob",
+			wantName:        "Bob",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userStore := storetest.NewUserStore()
+			bob := userStore.AddUser("bob", "password123")
+			bob, err := userStore.UpdateDisplayName(context.Background(), bob.ID, "Bob")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sessionStore := store.NewMemorySessionStore()
+
+			form := url.Values{"display-name": {test.displayName}}
+			r := signIn(t, newFormRequest(http.MethodPost, "/settings/display-name", form), sessionStore, bob, "session-id")
+			w := httptest.NewRecorder()
+			CreateChangeDisplayNameHandler(newTestApp(userStore, sessionStore))(w, r)
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), test.wantBody) {
+				t.Errorf("body does not contain %q", test.wantBody)
+			}
+
+			user, err := userStore.GetUserByID(context.Background(), bob.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.DisplayName != test.wantDisplayName {
+				t.Errorf("display name = %q, want %q", user.DisplayName, test.wantDisplayName)
+			}
+			if user.Name() != test.wantName {
+				t.Errorf("name = %q, want %q", user.Name(), test.wantName)
+			}
+		})
+	}
+}
+
+func TestCreateDeactivateAccountHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		password        string
+		wantStatus      int
+		wantBody        string
+		wantDeactivated bool
+	}{
+		{
+			name:            "deactivates the account",
+			password:        "password123",
+			wantStatus:      http.StatusSeeOther,
+			wantDeactivated: true,
+		},
+		{
+			name:       "rejects a wrong password",
+			password:   "wrong-password",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Password is incorrect.",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userStore := storetest.NewUserStore()
+			bob := userStore.AddUser("bob", "password123")
+			sessionStore := store.NewMemorySessionStore()
+			app := newTestApp(userStore, sessionStore)
+			app.Hub = chat.NewHub(nil, nil)
+			go app.Hub.Run()
+
+			sessionID := "session-id"
+			form := url.Values{"password": {test.password}}
+			r := signIn(t, newFormRequest(http.MethodPost, "/settings/deactivate", form), sessionStore, bob, sessionID)
+			w := httptest.NewRecorder()
+			CreateDeactivateAccountHandler(app)(w, r)
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), test.wantBody) {
+				t.Errorf("body does not contain %q", test.wantBody)
+			}
+
+			_, err := userStore.GetUserByID(context.Background(), bob.ID)
+			deactivated := errors.Is(err, store.ErrUserNotFound)
+			if deactivated != test.wantDeactivated {
+				t.Errorf("deactivated = %t, want %t", deactivated, test.wantDeactivated)
+			}
+
+			_, err = sessionStore.GetSession(context.Background(), sessionID)
+			deleted := errors.Is(err, store.ErrSessionNotFound)
+			if deleted != test.wantDeactivated {
+				t.Errorf("session deleted = %t, want %t", deleted, test.wantDeactivated)
+			}
+
+			cookie, ok := findCookie(w.Result())
+			if ok != test.wantDeactivated {
+				t.Fatalf("cookie set = %t, want %t", ok, test.wantDeactivated)
+			}
+			if ok && cookie.MaxAge >= 0 {
+				t.Errorf("cookie MaxAge = %d, want it cleared", cookie.MaxAge)
+			}
+		})
+	}
+}
@@ -4,66 +4,61 @@ package handlers
 
 import (
 	"errors"
-	"html/template"
-	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"gochat/main/internal/application"
 	"gochat/main/internal/forms"
+	"gochat/main/internal/ratelimit"
 	"gochat/main/internal/store"
 	"gochat/main/internal/utils/responses"
 	"gochat/main/internal/utils/sessions"
-
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 )
 
-func CreateLoginGetHandler(templates *template.Template) http.HandlerFunc {
-	data := map[string]any{
-		"errors": map[string]string{},
-		"form":   forms.LogInForm{},
-	}
-
+func CreateLoginGetHandler(app *application.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		responses.RenderTemplate(w, r, templates, "login.html", data)
+		responses.RenderTemplate(w, r, app.Templates, "login.html", map[string]any{
+			"errors": map[string]string{},
+			"form":   forms.LogInForm{},
+			// Set by the redirect after resetting a forgotten password.
+			"isPasswordReset": r.URL.Query().Has("password-reset"),
+			// Set by the redirect after signing up with an email.
+			"isVerificationSent": r.URL.Query().Has("verification-sent"),
+		})
 	}
 }
 
-func CreateSignUpGetHandler(templates *template.Template) http.HandlerFunc {
+func CreateSignUpGetHandler(app *application.App) http.HandlerFunc {
 	data := map[string]any{
 		"errors": map[string]string{},
 		"form":   forms.SignUpForm{},
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
-		responses.RenderTemplate(w, r, templates, "signup.html", data)
+		responses.RenderTemplate(w, r, app.Templates, "signup.html", data)
 	}
 }
 
-func isUniqueConstraintViolatedError(err error) bool {
-	var pgErr *pgconn.PgError
-	return errors.As(err, &pgErr) && pgErr.Code == "23505"
-}
-
-func CreateUserHandler(userService store.UserService, templates *template.Template) http.HandlerFunc {
+func CreateUserHandler(app *application.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		signUpForm := forms.NewSignUpFormFromRequest(r)
 
 		validationErrors := signUpForm.Validate()
 		if len(validationErrors) > 0 {
 			w.WriteHeader(http.StatusBadRequest)
-			responses.RenderTemplate(w, r, templates, "signup.html", map[string]any{
+			responses.RenderTemplate(w, r, app.Templates, "signup.html", map[string]any{
 				"errors": validationErrors,
 				"form":   signUpForm,
 			})
 			return
 		}
-		_, err := userService.CreateUser(signUpForm.Username, signUpForm.Password, r.Context())
+		user, err := app.Users.CreateUser(signUpForm.Username, signUpForm.Password, signUpForm.Email, r.Context())
 		if err != nil {
-			// Username is the only user populated field with a unique constraint.
-			// TODO: Kill function and add explicit conditional.
-			if isUniqueConstraintViolatedError(err) {
-
+			if errors.Is(err, store.ErrUsernameTaken) {
 				w.WriteHeader(http.StatusBadRequest)
-				responses.RenderTemplate(w, r, templates, "signup.html", map[string]any{
+				responses.RenderTemplate(w, r, app.Templates, "signup.html", map[string]any{
 					"errors": forms.ValidationErrors{
 						"Username": "A user with this username already exists.",
 					},
@@ -71,7 +66,7 @@ func CreateUserHandler(userService store.UserService, templates *template.Templa
 				})
 
 			} else {
-				responses.RenderInternalErrorOnTemplate(w, r, templates, "signup.html", map[string]any{
+				responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "signup.html", map[string]any{
 					"errors": map[string]string{},
 					"form":   signUpForm,
 				})
@@ -80,73 +75,86 @@ func CreateUserHandler(userService store.UserService, templates *template.Templa
 			return
 		}
 
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		if user.Email == "" {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		// The account exists either way, and another link can be sent from the settings page. Whether
+		// someone else has the email is not said, since that would tell anyone who has an account.
+		err = sendEmailVerification(r, app, user)
+		if err != nil {
+			app.Logger.ErrorContext(r.Context(), "Error sending email verification", "err", err)
+		}
+		http.Redirect(w, r, "/login?verification-sent", http.StatusSeeOther)
 	}
 }
 
-func CreateLoginHandler(userService store.UserService, sessionService store.SessionService, templates *template.Template) http.HandlerFunc {
+func CreateLoginHandler(app *application.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		loginForm := forms.NewLogInFormFromRequest(r)
 
 		validationErrors := loginForm.Validate()
 		if len(validationErrors) > 0 {
+			app.Metrics.Logins.Inc("failure")
 			w.WriteHeader(http.StatusBadRequest)
-			responses.RenderTemplate(w, r, templates, "login.html", map[string]any{
+			responses.RenderTemplate(w, r, app.Templates, "login.html", map[string]any{
 				"form":                  loginForm,
 				"areCredentialsInvalid": true,
 			})
 			return
 		}
 
-		user, err := userService.AuthenticateUser(r.Context(), loginForm.Username, loginForm.Password)
+		// Checked before the password so guesses past the limit cost next to nothing.
+		retryAfter := loginRetryAfter(r, app, loginForm.Username)
+		if retryAfter > 0 {
+			renderLoginRateLimited(w, r, app, loginForm, retryAfter)
+			return
+		}
+
+		user, err := app.Users.AuthenticateUser(r.Context(), loginForm.Username, loginForm.Password)
 		if err != nil {
 			if errors.Is(err, store.ErrInvalidCredentials) {
-				responses.RenderTemplate(w, r, templates, "login.html", map[string]any{
+				app.Metrics.Logins.Inc("failure")
+				responses.RenderTemplate(w, r, app.Templates, "login.html", map[string]any{
 					"form":                  loginForm,
 					"areCredentialsInvalid": true,
 				})
 			} else {
-				responses.RenderInternalErrorOnTemplate(w, r, templates, "login.html", map[string]any{})
-				log.Println(err)
+				responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "login.html", map[string]any{})
+				app.Logger.ErrorContext(r.Context(), "Error authenticating user", "err", err)
 			}
 			return
 		}
 
-		sessionCookie, err := sessions.CreateSessionCookie()
+		// Any session the browser already had is replaced so a planted session id can not be
+		// used to ride along with the user once they sign in.
+		err = rotateSession(w, r, app, user.ID)
 		if err != nil {
-			responses.RenderInternalErrorOnTemplate(w, r, templates, "login.html", map[string]any{})
-			log.Println(err)
+			responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "login.html", map[string]any{})
+			app.Logger.ErrorContext(r.Context(), "Error rotating session", "err", err)
 			return
 		}
 
-		_, err = sessionService.CreateSession(r.Context(), sessionCookie.Value, user.ID, sessionCookie.Expires)
-		if err != nil {
-			responses.RenderInternalErrorOnTemplate(w, r, templates, "login.html", map[string]any{})
-			log.Println(err)
-			return
-		}
-
-		http.SetCookie(w, &sessionCookie)
+		app.Metrics.Logins.Inc("success")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
 }
 
-func CreateLogoutHandler(userService store.UserService, sessionService store.SessionService, templates *template.Template) http.HandlerFunc {
+func CreateLogoutHandler(app *application.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		sessionCookie, err := r.Cookie(sessions.SessionCookieName)
+		sessionCookie, err := r.Cookie(sessions.CookieName())
 		if err != nil {
 			if !errors.Is(err, http.ErrNoCookie) {
-				log.Printf("Error getting session cookie when deleting: %v", err)
+				app.Logger.ErrorContext(r.Context(), "Error getting session cookie when deleting", "err", err)
 			}
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
 
-		err = sessionService.DeleteSession(r.Context(), sessionCookie.Value)
+		err = app.Sessions.DeleteSession(r.Context(), sessionCookie.Value)
 		if err != nil {
-			if !errors.Is(err, pgx.ErrNoRows) {
-				log.Printf("Error deleting session cookie from db: %v", err)
-			}
+			app.Logger.ErrorContext(r.Context(), "Error deleting session", "err", err)
 		}
 
 		clearSessionCookie := sessions.CreateClearSessionCookie()
@@ -154,3 +162,61 @@ func CreateLogoutHandler(userService store.UserService, sessionService store.Ses
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
 }
+
+// loginRetryAfter takes a sign in attempt from the limits on the client's IP address and on the
+// username, returning how long to wait if either has run out. A failing limiter lets the attempt
+// through, since the account lockout still stands behind it.
+func loginRetryAfter(r *http.Request, app *application.App, username string) time.Duration {
+	now := app.Clock.Now()
+	limits := []struct {
+		limiter *ratelimit.Limiter
+		key     string
+	}{
+		{app.LoginIPLimiter, app.TrustedProxies.ClientIP(r)},
+		// Usernames are folded so changing case does not earn more guesses.
+		{app.LoginUsernameLimiter, strings.ToLower(username)},
+	}
+
+	var retryAfter time.Duration
+	for _, limit := range limits {
+		result, err := limit.limiter.Allow(r.Context(), limit.key, now)
+		if err != nil {
+			app.Logger.ErrorContext(r.Context(), "Error checking sign in rate limit", "err", err)
+			continue
+		}
+		if !result.Allowed {
+			retryAfter = max(retryAfter, result.RetryAfter)
+		}
+	}
+	return retryAfter
+}
+
+// renderLoginRateLimited turns the attempt away with a 429 saying when to try again.
+func renderLoginRateLimited(w http.ResponseWriter, r *http.Request, app *application.App, loginForm forms.LogInForm, retryAfter time.Duration) {
+	app.Metrics.Logins.Inc("limited")
+
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+	responses.RenderTemplate(w, r, app.Templates, "login.html", map[string]any{
+		"form":          loginForm,
+		"isRateLimited": true,
+		"retryAfter":    formatRetryAfter(seconds),
+	})
+}
+
+// formatRetryAfter describes a wait in whole minutes, or seconds when under a minute.
+func formatRetryAfter(seconds int) string {
+	if seconds < 60 {
+		if seconds == 1 {
+			return "1 second"
+		}
+		return strconv.Itoa(seconds) + " seconds"
+	}
+
+	minutes := (seconds + 59) / 60
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return strconv.Itoa(minutes) + " minutes"
+}
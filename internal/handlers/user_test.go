@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/config"
+	"gochat/main/internal/mail"
+	"gochat/main/internal/models"
+	"gochat/main/internal/ratelimit"
+	"gochat/main/internal/store"
+	"gochat/main/internal/store/storetest"
+	"gochat/main/internal/utils/sessions"
+)
+
+var errStoreDown = errors.New("store is down")
+
+// newTestApp returns an app backed by the given fakes, with the real templates.
+func newTestApp(userStore store.UserStore, sessionStore store.SessionStore) *application.App {
+	cfg := config.Default()
+	rateLimits := ratelimit.NewMemoryStore()
+	logger := slog.New(slog.DiscardHandler)
+	return &application.App{
+		Config:    cfg,
+		Logger:    logger,
+		Templates: template.Must(template.ParseGlob("../../templates/*.html")),
+		Clock:     application.SystemClock,
+		Users:     userStore,
+		Sessions:  sessionStore,
+		SessionPolicy: sessions.Policy{
+			IdleTimeout:      cfg.Session.IdleTimeout,
+			AbsoluteLifetime: cfg.Session.AbsoluteLifetime,
+			RenewInterval:    cfg.Session.RenewInterval,
+		},
+		Metrics: application.NewMetrics(),
+		Mailer:  mail.NewLogMailer(logger),
+
+		LoginIPLimiter: ratelimit.NewLimiter(rateLimits, "login-ip",
+			ratelimit.Limit{Burst: cfg.Login.IPBurst, Interval: cfg.Login.IPInterval}),
+		LoginUsernameLimiter: ratelimit.NewLimiter(rateLimits, "login-username",
+			ratelimit.Limit{Burst: cfg.Login.UsernameBurst, Interval: cfg.Login.UsernameInterval}),
+		PasswordResetLimiter: ratelimit.NewLimiter(rateLimits, "password-reset-email",
+			ratelimit.Limit{Burst: cfg.PasswordReset.EmailBurst, Interval: cfg.PasswordReset.EmailInterval}),
+		EmailVerificationLimiter: ratelimit.NewLimiter(rateLimits, "email-verification-email",
+			ratelimit.Limit{Burst: cfg.EmailVerification.EmailBurst, Interval: cfg.EmailVerification.EmailInterval}),
+	}
+}
+
+func newFormRequest(method string, target string, form url.Values) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// findCookie returns the session cookie set on the response, if any.
+func findCookie(response *http.Response) (*http.Cookie, bool) {
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == sessions.CookieName() {
+			return cookie, true
+		}
+	}
+	return nil, false
+}
+
+func TestCreateUserHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		form         url.Values
+		storeErr     error
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+		wantUsers    int
+	}{
+		{
+			name:         "creates the user",
+			form:         url.Values{"username": {"alice"}, "password": {"password123"}, "confirm-password": {"password123"}},
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "/login",
+			wantUsers:    2,
+		},
+		{
+			name:       "rejects an empty username",
+			form:       url.Values{"username": {""}, "password": {"password123"}, "confirm-password": {"password123"}},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Username can not be empty.",
+			wantUsers:  1,
+		},
+		{
+			name:       "rejects mismatched passwords",
+			form:       url.Values{"username": {"alice"}, "password": {"password123"}, "confirm-password": {"password321"}},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Passwords do not match.",
+			wantUsers:  1,
+		},
+		{
+			name:       "rejects an invalid email",
+			form:       url.Values{"username": {"alice"}, "password": {"password123"}, "confirm-password": {"password123"}, "email": {"alice"}},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Email is not a valid email address.",
+			wantUsers:  1,
+		},
+		{
+			name:       "rejects a taken username",
+			form:       url.Values{"username": {"bob"}, "password": {"password123"}, "confirm-password": {"password123"}},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "A user with this username already exists.",
+			wantUsers:  1,
+		},
+		{
+			name:       "shows the error banner when the store fails",
+			form:       url.Values{"username": {"alice"}, "password": {"password123"}, "confirm-password": {"password123"}},
+			storeErr:   errStoreDown,
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   "An internal error occured.",
+			wantUsers:  1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userStore := storetest.NewUserStore()
+			bob := userStore.AddUser("bob", "password123")
+			_, err := userStore.UpdateEmail(context.Background(), bob.ID, "bob@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			userStore.Err = test.storeErr
+
+			w := httptest.NewRecorder()
+			CreateUserHandler(newTestApp(userStore, store.NewMemorySessionStore()))(w, newFormRequest(http.MethodPost, "/signup", test.form))
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			if location := w.Header().Get("Location"); location != test.wantLocation {
+				t.Errorf("Location = %q, want %q", location, test.wantLocation)
+			}
+			if !strings.Contains(w.Body.String(), test.wantBody) {
+				t.Errorf("body does not contain %q", test.wantBody)
+			}
+
+			userStore.Err = nil
+			if users := userStore.Users(); len(users) != test.wantUsers {
+				t.Errorf("store has %d users, want %d", len(users), test.wantUsers)
+			}
+		})
+	}
+}
+
+func TestCreateLoginHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		form         url.Values
+		deactivated  bool
+		storeErr     error
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+		wantSession  bool
+		// wantResult is the result the attempt is counted under in the login metric, if any.
+		wantResult string
+	}{
+		{
+			name:         "signs the user in",
+			form:         url.Values{"username": {"bob"}, "password": {"password123"}},
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "/",
+			wantSession:  true,
+			wantResult:   "success",
+		},
+		{
+			name:       "rejects a wrong password",
+			form:       url.Values{"username": {"bob"}, "password": {"wrong-password"}},
+			wantStatus: http.StatusOK,
+			wantBody:   "We couldn't find a user with the given credentials.",
+			wantResult: "failure",
+		},
+		{
+			name:       "rejects an unknown user",
+			form:       url.Values{"username": {"alice"}, "password": {"password123"}},
+			wantStatus: http.StatusOK,
+			wantBody:   "We couldn't find a user with the given credentials.",
+			wantResult: "failure",
+		},
+		{
+			name:        "rejects a deactivated user",
+			form:        url.Values{"username": {"bob"}, "password": {"password123"}},
+			deactivated: true,
+			wantStatus:  http.StatusOK,
+			wantBody:    "We couldn't find a user with the given credentials.",
+			wantResult:  "failure",
+		},
+		{
+			name:       "rejects a short password without checking it",
+			form:       url.Values{"username": {"bob"}, "password": {"short"}},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "We couldn't find a user with the given credentials.",
+			wantResult: "failure",
+		},
+		{
+			name:       "shows the error banner when the store fails",
+			form:       url.Values{"username": {"bob"}, "password": {"password123"}},
+			storeErr:   errStoreDown,
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   "An internal error occured.",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userStore := storetest.NewUserStore()
+			bob := userStore.AddUser("bob", "password123")
+			if test.deactivated {
+				userStore.Deactivate(bob.ID)
+			}
+			userStore.Err = test.storeErr
+			sessionStore := store.NewMemorySessionStore()
+
+			w := httptest.NewRecorder()
+			app := newTestApp(userStore, sessionStore)
+			CreateLoginHandler(app)(w, newFormRequest(http.MethodPost, "/login", test.form))
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			if location := w.Header().Get("Location"); location != test.wantLocation {
+				t.Errorf("Location = %q, want %q", location, test.wantLocation)
+			}
+			if !strings.Contains(w.Body.String(), test.wantBody) {
+				t.Errorf("body does not contain %q", test.wantBody)
+			}
+			for _, result := range []string{"success", "failure"} {
+				want := 0.0
+				if result == test.wantResult {
+					want = 1
+				}
+				if got := app.Metrics.Logins.Value(result); got != want {
+					t.Errorf("logins counted as %s = %v, want %v", result, got, want)
+				}
+			}
+
+			cookie, hasCookie := findCookie(w.Result())
+			if hasCookie != test.wantSession {
+				t.Fatalf("session cookie set = %t, want %t", hasCookie, test.wantSession)
+			}
+			if !test.wantSession {
+				return
+			}
+
+			session, err := sessionStore.GetSession(context.Background(), cookie.Value)
+			if err != nil {
+				t.Fatalf("session from cookie: %v", err)
+			}
+			if session.UserID != bob.ID {
+				t.Errorf("session user = %d, want %d", session.UserID, bob.ID)
+			}
+			if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteStrictMode {
+				t.Errorf("cookie attributes = %+v, want HttpOnly, Secure and SameSite=Strict", cookie)
+			}
+		})
+	}
+}
+
+func TestCreateLoginHandlerRotatesSession(t *testing.T) {
+	userStore := storetest.NewUserStore()
+	bob := userStore.AddUser("bob", "password123")
+	sessionStore := store.NewMemorySessionStore()
+
+	// A session id planted in the browser before signing in.
+	plantedSessionID := "planted-session-id"
+	_, err := sessionStore.CreateSession(context.Background(), plantedSessionID, bob.ID, time.Now().Add(time.Hour), models.SessionMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newFormRequest(http.MethodPost, "/login", url.Values{"username": {"bob"}, "password": {"password123"}})
+	r.AddCookie(&http.Cookie{Name: sessions.CookieName(), Value: plantedSessionID})
+	w := httptest.NewRecorder()
+	CreateLoginHandler(newTestApp(userStore, sessionStore))(w, r)
+
+	cookie, ok := findCookie(w.Result())
+	if !ok {
+		t.Fatal("no session cookie set")
+	}
+	if cookie.Value == plantedSessionID {
+		t.Error("session id was not rotated")
+	}
+	_, err = sessionStore.GetSession(context.Background(), plantedSessionID)
+	if !errors.Is(err, store.ErrSessionNotFound) {
+		t.Errorf("planted session still exists, err = %v", err)
+	}
+}
+
+func TestCreateLoginHandlerLimitsAttempts(t *testing.T) {
+	bobWrong := url.Values{"username": {"bob"}, "password": {"wrong-password"}}
+	bobRight := url.Values{"username": {"bob"}, "password": {"password123"}}
+
+	repeat := func(form url.Values, n int) []url.Values {
+		forms := make([]url.Values, n)
+		for i := range forms {
+			forms[i] = form
+		}
+		return forms
+	}
+
+	tests := []struct {
+		name    string
+		lockout store.LockoutPolicy
+		// attempts are made in order, the last is the one checked.
+		attempts      []url.Values
+		wantStatus    int
+		wantLocation  string
+		wantRateLimit bool
+		wantInvalid   bool
+	}{
+		{
+			name:        "allows attempts up to the username limit",
+			attempts:    repeat(bobWrong, 5),
+			wantStatus:  http.StatusOK,
+			wantInvalid: true,
+		},
+		{
+			name:          "limits attempts at a username",
+			attempts:      append(repeat(bobWrong, 5), bobRight),
+			wantStatus:    http.StatusTooManyRequests,
+			wantRateLimit: true,
+		},
+		{
+			name: "limits attempts at a username whatever its case",
+			attempts: []url.Values{
+				{"username": {"bob"}, "password": {"wrong-guess-1"}},
+				{"username": {"Bob"}, "password": {"wrong-guess-2"}},
+				{"username": {"BOB"}, "password": {"wrong-guess-3"}},
+				{"username": {"bOb"}, "password": {"wrong-guess-4"}},
+				{"username": {"boB"}, "password": {"wrong-guess-5"}},
+				bobRight,
+			},
+			wantStatus:    http.StatusTooManyRequests,
+			wantRateLimit: true,
+		},
+		{
+			name: "limits attempts from an address",
+			attempts: func() []url.Values {
+				var forms []url.Values
+				for i := range 20 {
+					forms = append(forms, url.Values{"username": {fmt.Sprintf("user%d", i)}, "password": {"password123"}})
+				}
+				return append(forms, bobRight)
+			}(),
+			wantStatus:    http.StatusTooManyRequests,
+			wantRateLimit: true,
+		},
+		{
+			// The lockout looks just like a wrong password, or it would show the username is taken.
+			name:        "locks out the account after repeated failures",
+			lockout:     store.LockoutPolicy{Threshold: 3, BaseDuration: time.Minute, MaxDuration: time.Hour},
+			attempts:    append(repeat(bobWrong, 3), bobRight),
+			wantStatus:  http.StatusOK,
+			wantInvalid: true,
+		},
+		{
+			name:         "signs in below the lockout threshold",
+			lockout:      store.LockoutPolicy{Threshold: 3, BaseDuration: time.Minute, MaxDuration: time.Hour},
+			attempts:     append(repeat(bobWrong, 2), bobRight),
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "/",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userStore := storetest.NewUserStore()
+			userStore.AddUser("bob", "password123")
+			userStore.Lockout = test.lockout
+			app := newTestApp(userStore, store.NewMemorySessionStore())
+
+			var w *httptest.ResponseRecorder
+			for _, form := range test.attempts {
+				w = httptest.NewRecorder()
+				CreateLoginHandler(app)(w, newFormRequest(http.MethodPost, "/login", form))
+			}
+
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			if location := w.Header().Get("Location"); location != test.wantLocation {
+				t.Errorf("Location = %q, want %q", location, test.wantLocation)
+			}
+			isRateLimited := strings.Contains(w.Body.String(), "Too many sign in attempts.")
+			if isRateLimited != test.wantRateLimit {
+				t.Errorf("shows the rate limit message = %t, want %t", isRateLimited, test.wantRateLimit)
+			}
+			if retryAfter := w.Header().Get("Retry-After"); test.wantRateLimit && retryAfter == "" {
+				t.Error("Retry-After is not set")
+			}
+			isInvalid := strings.Contains(w.Body.String(), "We couldn't find a user with the given credentials.")
+			if isInvalid != test.wantInvalid {
+				t.Errorf("shows the invalid credentials message = %t, want %t", isInvalid, test.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestFormatRetryAfter(t *testing.T) {
+	tests := []struct {
+		seconds int
+		want    string
+	}{
+		{1, "1 second"},
+		{45, "45 seconds"},
+		{60, "1 minute"},
+		{61, "2 minutes"},
+		{3600, "60 minutes"},
+	}
+
+	for _, test := range tests {
+		if got := formatRetryAfter(test.seconds); got != test.want {
+			t.Errorf("formatRetryAfter(%d) = %q, want %q", test.seconds, got, test.want)
+		}
+	}
+}
+
+func TestCreateLogoutHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		cookie          bool
+		wantClearCookie bool
+	}{
+		{
+			name:            "deletes the session",
+			cookie:          true,
+			wantClearCookie: true,
+		},
+		{
+			name:   "does nothing without a session",
+			cookie: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userStore := storetest.NewUserStore()
+			bob := userStore.AddUser("bob", "password123")
+			sessionStore := store.NewMemorySessionStore()
+
+			sessionID := "session-id"
+			_, err := sessionStore.CreateSession(context.Background(), sessionID, bob.ID, time.Now().Add(time.Hour), models.SessionMetadata{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/logout", nil)
+			if test.cookie {
+				r.AddCookie(&http.Cookie{Name: sessions.CookieName(), Value: sessionID})
+			}
+			w := httptest.NewRecorder()
+			CreateLogoutHandler(newTestApp(userStore, sessionStore))(w, r)
+
+			if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/" {
+				t.Errorf("response = %d %q, want a redirect to /", w.Code, w.Header().Get("Location"))
+			}
+
+			cookie, ok := findCookie(w.Result())
+			if ok != test.wantClearCookie {
+				t.Fatalf("cookie set = %t, want %t", ok, test.wantClearCookie)
+			}
+			if ok && cookie.MaxAge >= 0 {
+				t.Errorf("cookie MaxAge = %d, want it cleared", cookie.MaxAge)
+			}
+
+			_, err = sessionStore.GetSession(context.Background(), sessionID)
+			deleted := errors.Is(err, store.ErrSessionNotFound)
+			if deleted != test.cookie {
+				t.Errorf("session deleted = %t, want %t", deleted, test.cookie)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Package jobs contains the background work the server runs alongside handling requests.
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gochat/main/internal/store"
+)
+
+type SessionSweeperOptions struct {
+	// Interval is the time between sweeps.
+	Interval time.Duration
+	// BatchSize is the most sessions or tokens deleted by one statement, which keeps each delete short
+	// so it does not hold locks other requests are waiting on.
+	BatchSize int
+}
+
+// SessionSweeper periodically deletes expired sessions, password reset tokens and email
+// verification tokens so they do not pile up in their stores.
+type SessionSweeper struct {
+	sessionStore           store.SessionStore
+	passwordResetStore     store.PasswordResetStore
+	emailVerificationStore store.EmailVerificationStore
+	options                SessionSweeperOptions
+
+	totalPurged atomic.Int64
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewSessionSweeper(sessionStore store.SessionStore, passwordResetStore store.PasswordResetStore, emailVerificationStore store.EmailVerificationStore, options SessionSweeperOptions) *SessionSweeper {
+	return &SessionSweeper{
+		sessionStore:           sessionStore,
+		passwordResetStore:     passwordResetStore,
+		emailVerificationStore: emailVerificationStore,
+		options:                options,
+	}
+}
+
+// Start sweeps once immediately, then every interval until Stop is called.
+func (sweeper *SessionSweeper) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	sweeper.cancel = cancel
+
+	sweeper.wg.Add(1)
+	go func() {
+		defer sweeper.wg.Done()
+
+		ticker := time.NewTicker(sweeper.options.Interval)
+		defer ticker.Stop()
+
+		for {
+			sweeper.sweepAndLog(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop cancels any sweep in progress and waits for the sweeper to exit.
+func (sweeper *SessionSweeper) Stop() {
+	if sweeper.cancel == nil {
+		return
+	}
+
+	sweeper.cancel()
+	sweeper.wg.Wait()
+}
+
+// TotalPurged returns the number of sessions deleted since the sweeper was created.
+func (sweeper *SessionSweeper) TotalPurged() int64 {
+	return sweeper.totalPurged.Load()
+}
+
+// Sweep deletes expired sessions in batches until there are none left and returns how many were deleted.
+func (sweeper *SessionSweeper) Sweep(ctx context.Context) (int64, error) {
+	purged, err := sweeper.deleteInBatches(ctx, sweeper.sessionStore.DeleteExpiredSessions)
+	sweeper.totalPurged.Add(purged)
+	return purged, err
+}
+
+// SweepPasswordResetTokens deletes expired password reset tokens in batches until there are none
+// left and returns how many were deleted.
+func (sweeper *SessionSweeper) SweepPasswordResetTokens(ctx context.Context) (int64, error) {
+	return sweeper.deleteInBatches(ctx, sweeper.passwordResetStore.DeleteExpiredPasswordResetTokens)
+}
+
+// SweepEmailVerificationTokens deletes expired email verification tokens in batches until there
+// are none left and returns how many were deleted.
+func (sweeper *SessionSweeper) SweepEmailVerificationTokens(ctx context.Context) (int64, error) {
+	return sweeper.deleteInBatches(ctx, sweeper.emailVerificationStore.DeleteExpiredEmailVerificationTokens)
+}
+
+// deleteInBatches calls deleteExpired until it deletes less than a full batch.
+func (sweeper *SessionSweeper) deleteInBatches(ctx context.Context, deleteExpired func(ctx context.Context, limit int) (int64, error)) (int64, error) {
+	var purged int64
+	for {
+		deleted, err := deleteExpired(ctx, sweeper.options.BatchSize)
+		purged += deleted
+		if err != nil {
+			return purged, err
+		}
+
+		// A short batch means we have caught up.
+		if deleted < int64(sweeper.options.BatchSize) {
+			return purged, nil
+		}
+	}
+}
+
+func (sweeper *SessionSweeper) sweepAndLog(ctx context.Context) {
+	start := time.Now()
+
+	purged, err := sweeper.Sweep(ctx)
+	if err != nil && ctx.Err() == nil {
+		slog.Error("Error sweeping expired sessions", "purged", purged, "err", err)
+	} else if err == nil {
+		slog.Info("Purged expired sessions", "purged", purged, "duration", time.Since(start).Round(time.Millisecond), "total_purged", sweeper.TotalPurged())
+	}
+
+	// A failure sweeping one store says nothing about the others, so they are swept anyway.
+	start = time.Now()
+	purged, err = sweeper.SweepPasswordResetTokens(ctx)
+	if err != nil && ctx.Err() == nil {
+		slog.Error("Error sweeping expired password reset tokens", "purged", purged, "err", err)
+	} else if err == nil {
+		slog.Info("Purged expired password reset tokens", "purged", purged, "duration", time.Since(start).Round(time.Millisecond))
+	}
+
+	start = time.Now()
+	purged, err = sweeper.SweepEmailVerificationTokens(ctx)
+	if err != nil && ctx.Err() == nil {
+		slog.Error("Error sweeping expired email verification tokens", "purged", purged, "err", err)
+	} else if err == nil {
+		slog.Info("Purged expired email verification tokens", "purged", purged, "duration", time.Since(start).Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"gochat/main/internal/models"
+	"gochat/main/internal/store"
+	"gochat/main/internal/store/storetest"
+)
+
+func TestSessionSweeperDeletesExpiredSessionsAndTokens(t *testing.T) {
+	ctx := context.Background()
+	sessions := store.NewMemorySessionStore()
+	users := storetest.NewUserStore()
+	bob := users.AddUser("bob", "password123")
+	resets := storetest.NewPasswordResetStore(users)
+	verifications := storetest.NewEmailVerificationStore(users)
+
+	// More than a batch of each is expired, to check the sweep keeps going until it has caught up.
+	for i := range 5 {
+		_, err := sessions.CreateSession(ctx, fmt.Sprintf("expired-%d", i), bob.ID, time.Now().Add(-time.Minute), models.SessionMetadata{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = resets.CreatePasswordResetToken(ctx, fmt.Sprintf("expired-%d", i), bob.ID, -time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = verifications.CreateEmailVerificationToken(ctx, fmt.Sprintf("expired-%d", i), bob.ID, "bob@example.com", -time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := sessions.CreateSession(ctx, "current", bob.ID, time.Now().Add(time.Hour), models.SessionMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resets.CreatePasswordResetToken(ctx, "current", bob.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = verifications.CreateEmailVerificationToken(ctx, "current", bob.ID, "bob@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sweeper := NewSessionSweeper(sessions, resets, verifications, SessionSweeperOptions{Interval: time.Hour, BatchSize: 2})
+
+	purged, err := sweeper.Sweep(ctx)
+	if err != nil || purged != 5 {
+		t.Errorf("Sweep = %d, %v, want 5 sessions", purged, err)
+	}
+	_, err = sessions.GetSession(ctx, "current")
+	if err != nil {
+		t.Errorf("current session was swept: %v", err)
+	}
+
+	purged, err = sweeper.SweepPasswordResetTokens(ctx)
+	if err != nil || purged != 5 {
+		t.Errorf("SweepPasswordResetTokens = %d, %v, want 5 tokens", purged, err)
+	}
+	if got := resets.Tokens(); got != 1 {
+		t.Errorf("%d reset tokens left, want the current one", got)
+	}
+
+	purged, err = sweeper.SweepEmailVerificationTokens(ctx)
+	if err != nil || purged != 5 {
+		t.Errorf("SweepEmailVerificationTokens = %d, %v, want 5 tokens", purged, err)
+	}
+	if got := verifications.Tokens(); got != 1 {
+		t.Errorf("%d verification tokens left, want the current one", got)
+	}
+}
@@ -0,0 +1,97 @@
+// Package logging sets up structured logging. Log lines written with a request's context carry the
+// request id, the signed in user's id and the matched route.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+type contextKey struct{}
+
+// requestFields are the attributes added to every line logged for a request. They are filled in as
+// the request passes through the middleware and router, so they are only touched by the goroutine
+// serving the request.
+type requestFields struct {
+	requestID string
+	userID    int64
+	route     string
+}
+
+// WithRequestID returns a context for a new request, which later log lines are tagged with.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestFields{requestID: requestID})
+}
+
+// RequestID returns the id of the request the context belongs to, if any.
+func RequestID(ctx context.Context) string {
+	fields, ok := ctx.Value(contextKey{}).(*requestFields)
+	if !ok {
+		return ""
+	}
+	return fields.requestID
+}
+
+// SetUserID records the signed in user for the rest of the request's log lines.
+func SetUserID(ctx context.Context, userID int64) {
+	if fields, ok := ctx.Value(contextKey{}).(*requestFields); ok {
+		fields.userID = userID
+	}
+}
+
+// Route returns the route pattern recorded for the request, if any.
+func Route(ctx context.Context) string {
+	fields, ok := ctx.Value(contextKey{}).(*requestFields)
+	if !ok {
+		return ""
+	}
+	return fields.route
+}
+
+// SetRoute records the route pattern which matched the request.
+func SetRoute(ctx context.Context, route string) {
+	if fields, ok := ctx.Value(contextKey{}).(*requestFields); ok {
+		fields.route = route
+	}
+}
+
+// ContextHandler adds the request fields found in the context to each record.
+type ContextHandler struct {
+	slog.Handler
+}
+
+func (handler ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if fields, ok := ctx.Value(contextKey{}).(*requestFields); ok {
+		record.AddAttrs(slog.String("request_id", fields.requestID))
+		if fields.userID != 0 {
+			record.AddAttrs(slog.Int64("user_id", fields.userID))
+		}
+		if fields.route != "" {
+			record.AddAttrs(slog.String("route", fields.route))
+		}
+	}
+	return handler.Handler.Handle(ctx, record)
+}
+
+func (handler ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return ContextHandler{handler.Handler.WithAttrs(attrs)}
+}
+
+func (handler ContextHandler) WithGroup(name string) slog.Handler {
+	return ContextHandler{handler.Handler.WithGroup(name)}
+}
+
+// NewLogger creates a logger writing JSON lines at or above the level, which is one of debug,
+// info, warn or error.
+func NewLogger(w io.Writer, level string) (*slog.Logger, error) {
+	var slogLevel slog.Level
+	err := slogLevel.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	jsonHandler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slogLevel})
+	return slog.New(ContextHandler{jsonHandler}), nil
+}
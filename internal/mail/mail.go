@@ -0,0 +1,220 @@
+// Package mail sends email, such as password reset links.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email to a single recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+var ErrInvalidHeader = errors.New("email header contains a line break")
+
+// format renders the message with its headers, ready to be sent. Lines end in CRLF as SMTP expects.
+func (message Message) format(from string, date time.Time) ([]byte, error) {
+	// A line break in a header would let whoever chose it add headers, or even recipients.
+	for _, header := range []string{from, message.To, message.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", message.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+
+	body := strings.ReplaceAll(message.Body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	if !strings.HasSuffix(body, "\n") {
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// LogMailer logs messages instead of sending them, for local development. The logs then hold the
+// messages, password reset links and all, so it must not be used in production.
+type LogMailer struct {
+	logger *slog.Logger
+}
+
+var _ Mailer = LogMailer{}
+
+func NewLogMailer(logger *slog.Logger) LogMailer {
+	return LogMailer{logger: logger}
+}
+
+func (mailer LogMailer) Send(ctx context.Context, message Message) error {
+	mailer.logger.InfoContext(ctx, "Email not sent, logged instead",
+		"to", message.To,
+		"subject", message.Subject,
+		"body", message.Body,
+	)
+	return nil
+}
+
+// FileMailer writes each message to its own .eml file in a directory instead of sending it, so
+// messages can be opened in a mail client while testing offline.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+var _ Mailer = FileMailer{}
+
+func NewFileMailer(dir string, from string) FileMailer {
+	return FileMailer{
+		dir:  dir,
+		from: from,
+	}
+}
+
+func (mailer FileMailer) Send(ctx context.Context, message Message) error {
+	now := time.Now()
+	contents, err := message.format(mailer.from, now)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(mailer.dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	// Named by time so they list in the order they were sent.
+	file, err := os.CreateTemp(mailer.dir, now.UTC().Format("20060102T150405.000000000")+"-*.eml")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(contents)
+	return errors.Join(err, file.Close())
+}
+
+// SMTPOptions configures an SMTPMailer.
+type SMTPOptions struct {
+	Host string
+	Port int
+	// Username and Password are only used if the username is set. The password is only ever sent
+	// over TLS, or to localhost.
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer sends messages through an SMTP server, upgrading the connection with STARTTLS when
+// the server offers it.
+type SMTPMailer struct {
+	options SMTPOptions
+}
+
+var _ Mailer = (*SMTPMailer)(nil)
+
+func NewSMTPMailer(options SMTPOptions) *SMTPMailer {
+	return &SMTPMailer{options: options}
+}
+
+func (mailer *SMTPMailer) Send(ctx context.Context, message Message) error {
+	contents, err := message.format(mailer.options.From, time.Now())
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(mailer.options.Host, strconv.Itoa(mailer.options.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// net/smtp knows nothing of contexts, so the deadline is the only way to bound the whole exchange.
+	deadline, ok := ctx.Deadline()
+	if ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return err
+		}
+	}
+
+	client, err := smtp.NewClient(conn, mailer.options.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: mailer.options.Host})
+		if err != nil {
+			return err
+		}
+	}
+
+	if mailer.options.Username != "" {
+		auth := smtp.PlainAuth("", mailer.options.Username, mailer.options.Password, mailer.options.Host)
+		err = client.Auth(auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(envelopeAddress(mailer.options.From))
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(envelopeAddress(message.To))
+	if err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(contents)
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// envelopeAddress returns the bare address from a header value such as "GoChat <noreply@example.com>".
+func envelopeAddress(header string) string {
+	address, err := netmail.ParseAddress(header)
+	if err != nil {
+		// Left for the server to reject.
+		return header
+	}
+	return address.Address
+}
@@ -0,0 +1,180 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageFormat(t *testing.T) {
+	message := Message{
+		To:      "bob@example.com",
+		Subject: "Reset your password",
+		Body:    "Hello,\nfollow the link.",
+	}
+	date := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	contents, err := message.format("GoChat <noreply@example.com>", date)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "From: GoChat <noreply@example.com>\r\n" +
+		"To: bob@example.com\r\n" +
+		"Subject: Reset your password\r\n" +
+		"Date: Fri, 02 Jan 2026 03:04:05 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n" +
+		"\r\n" +
+		"Hello,\r\nfollow the link.\r\n"
+	if string(contents) != want {
+		t.Errorf("format =\n%q\nwant\n%q", contents, want)
+	}
+}
+
+func TestMessageFormatRejectsLineBreaksInHeaders(t *testing.T) {
+	messages := []Message{
+		{To: "bob@example.com\r\nBcc: eve@example.com", Subject: "Hello"},
+		{To: "bob@example.com", Subject: "Hello\nBcc: eve@example.com"},
+	}
+
+	for _, message := range messages {
+		_, err := message.format("noreply@example.com", time.Now())
+		if !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("format(%q, %q) err = %v, want %v", message.To, message.Subject, err, ErrInvalidHeader)
+		}
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := NewFileMailer(dir, "noreply@example.com")
+
+	err := mailer.Send(context.Background(), Message{To: "bob@example.com", Subject: "Hello", Body: "Hi Bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("wrote %d files, want 1", len(files))
+	}
+	contents, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(contents), "To: bob@example.com\r\n") || !strings.HasSuffix(string(contents), "Hi Bob\r\n") {
+		t.Errorf("file contents = %q", contents)
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	type received struct {
+		commands []string
+		data     string
+		err      error
+	}
+	done := make(chan received, 1)
+	go func() {
+		var result received
+		result.commands, result.data, result.err = serveSMTP(listener)
+		done <- result
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	mailer := NewSMTPMailer(SMTPOptions{
+		Host: "127.0.0.1",
+		Port: addr.Port,
+		From: "GoChat <noreply@example.com>",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = mailer.Send(ctx, Message{To: "bob@example.com", Subject: "Hello", Body: "Hi Bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := <-done
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	wantCommands := []string{"MAIL FROM:<noreply@example.com>", "RCPT TO:<bob@example.com>", "DATA", "QUIT"}
+	if strings.Join(result.commands, "|") != strings.Join(wantCommands, "|") {
+		t.Errorf("commands = %q, want %q", result.commands, wantCommands)
+	}
+	if !strings.Contains(result.data, "Subject: Hello\r\n") || !strings.HasSuffix(result.data, "Hi Bob\r\n") {
+		t.Errorf("data = %q", result.data)
+	}
+}
+
+// serveSMTP plays a minimal SMTP server offering no extensions for one connection, returning the
+// commands after the greeting and the message data.
+func serveSMTP(listener net.Listener) ([]string, string, error) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	text := textproto.NewConn(conn)
+	err = text.PrintfLine("220 localhost ready")
+	if err != nil {
+		return nil, "", err
+	}
+
+	var commands []string
+	var data string
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return nil, "", err
+		}
+
+		switch {
+		case strings.HasPrefix(line, "EHLO"):
+			err = text.PrintfLine("250 localhost")
+		case line == "DATA":
+			commands = append(commands, line)
+			err = text.PrintfLine("354 go ahead")
+			if err != nil {
+				return nil, "", err
+			}
+			var lines []byte
+			lines, err = text.ReadDotBytes()
+			if err != nil {
+				return nil, "", err
+			}
+			// ReadDotBytes turns line endings into bare newlines.
+			data = strings.ReplaceAll(string(lines), "\n", "\r\n")
+			err = text.PrintfLine("250 queued")
+		case line == "QUIT":
+			commands = append(commands, line)
+			text.PrintfLine("221 bye")
+			return commands, data, nil
+		default:
+			commands = append(commands, line)
+			err = text.PrintfLine("250 ok")
+		}
+		if err != nil {
+			return nil, "", err
+		}
+	}
+}
@@ -0,0 +1,317 @@
+// Package metrics keeps counters, gauges and histograms and serves them in the Prometheus text
+// format. It covers just what the server needs rather than pulling in the Prometheus client.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector is a metric family the registry can write out.
+type Collector interface {
+	// write writes the samples of the family, without the HELP and TYPE lines.
+	write(ctx context.Context, w io.Writer) error
+	describe() description
+}
+
+type description struct {
+	name string
+	help string
+	// kind is the Prometheus type, counter, gauge or histogram.
+	kind string
+}
+
+// Registry holds the collectors served on /metrics.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds the collectors, which are written out in the order they were registered.
+func (registry *Registry) Register(collectors ...Collector) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.collectors = append(registry.collectors, collectors...)
+}
+
+// WriteTo writes every collector in the Prometheus text format. A collector which fails is logged
+// and left without samples, so one broken source does not hide the rest.
+func (registry *Registry) WriteTo(ctx context.Context, w io.Writer) error {
+	registry.mu.Lock()
+	collectors := slices.Clone(registry.collectors)
+	registry.mu.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, collector := range collectors {
+		desc := collector.describe()
+		fmt.Fprintf(buf, "# HELP %s %s\n", desc.name, escapeHelp(desc.help))
+		fmt.Fprintf(buf, "# TYPE %s %s\n", desc.name, desc.kind)
+
+		err := collector.write(ctx, buf)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to collect metric", "metric", desc.name, "err", err)
+		}
+	}
+	return buf.Flush()
+}
+
+// ServeHTTP serves the metrics for a Prometheus scrape.
+func (registry *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	err := registry.WriteTo(r.Context(), w)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to write metrics", "err", err)
+	}
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	desc       description
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labelValues []string
+	value       float64
+}
+
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{
+		desc:       description{name: name, help: help, kind: "counter"},
+		labelNames: labelNames,
+		values:     make(map[string]*counterValue),
+	}
+}
+
+// Inc adds one to the counter with the label values, given in the order of the label names.
+func (counter *CounterVec) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+// Add adds a non-negative amount to the counter with the label values.
+func (counter *CounterVec) Add(amount float64, labelValues ...string) {
+	if len(labelValues) != len(counter.labelNames) {
+		panic(fmt.Sprintf("metric %s takes %d labels, got %d", counter.desc.name, len(counter.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	value, ok := counter.values[key]
+	if !ok {
+		value = &counterValue{labelValues: slices.Clone(labelValues)}
+		counter.values[key] = value
+	}
+	value.value += amount
+}
+
+// Value returns the current count with the label values, mostly for tests.
+func (counter *CounterVec) Value(labelValues ...string) float64 {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	value, ok := counter.values[strings.Join(labelValues, "\xff")]
+	if !ok {
+		return 0
+	}
+	return value.value
+}
+
+func (counter *CounterVec) describe() description {
+	return counter.desc
+}
+
+func (counter *CounterVec) write(ctx context.Context, w io.Writer) error {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	for _, key := range sortedKeys(counter.values) {
+		value := counter.values[key]
+		writeSample(w, counter.desc.name, counter.labelNames, value.labelValues, value.value)
+	}
+	return nil
+}
+
+// HistogramVec counts observations into buckets, partitioned by labels.
+type HistogramVec struct {
+	desc       description
+	labelNames []string
+	// buckets are the upper bounds, in increasing order, not including +Inf.
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labelValues []string
+	// counts holds the observations in each bucket on its own, they are summed when written.
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// DefaultBuckets suit request latencies in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+func NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return &HistogramVec{
+		desc:       description{name: name, help: help, kind: "histogram"},
+		labelNames: labelNames,
+		buckets:    buckets,
+		values:     make(map[string]*histogramValue),
+	}
+}
+
+// Observe records the value in the histogram with the label values.
+func (histogram *HistogramVec) Observe(value float64, labelValues ...string) {
+	if len(labelValues) != len(histogram.labelNames) {
+		panic(fmt.Sprintf("metric %s takes %d labels, got %d", histogram.desc.name, len(histogram.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+
+	entry, ok := histogram.values[key]
+	if !ok {
+		entry = &histogramValue{
+			labelValues: slices.Clone(labelValues),
+			counts:      make([]uint64, len(histogram.buckets)),
+		}
+		histogram.values[key] = entry
+	}
+
+	bucket, _ := slices.BinarySearch(histogram.buckets, value)
+	if bucket < len(histogram.buckets) {
+		entry.counts[bucket]++
+	}
+	entry.count++
+	entry.sum += value
+}
+
+func (histogram *HistogramVec) describe() description {
+	return histogram.desc
+}
+
+func (histogram *HistogramVec) write(ctx context.Context, w io.Writer) error {
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+
+	labelNames := append(slices.Clone(histogram.labelNames), "le")
+	for _, key := range sortedKeys(histogram.values) {
+		entry := histogram.values[key]
+
+		var cumulative uint64
+		for i, upperBound := range histogram.buckets {
+			cumulative += entry.counts[i]
+			labelValues := append(slices.Clone(entry.labelValues), formatFloat(upperBound))
+			writeSample(w, histogram.desc.name+"_bucket", labelNames, labelValues, float64(cumulative))
+		}
+		labelValues := append(slices.Clone(entry.labelValues), "+Inf")
+		writeSample(w, histogram.desc.name+"_bucket", labelNames, labelValues, float64(entry.count))
+		writeSample(w, histogram.desc.name+"_sum", histogram.labelNames, entry.labelValues, entry.sum)
+		writeSample(w, histogram.desc.name+"_count", histogram.labelNames, entry.labelValues, float64(entry.count))
+	}
+	return nil
+}
+
+// ValueFunc reads a value kept elsewhere, such as a pool's statistics, at scrape time.
+type ValueFunc func(ctx context.Context) (float64, error)
+
+// funcCollector is a single unlabelled value read at scrape time.
+type funcCollector struct {
+	desc description
+	fn   ValueFunc
+}
+
+// NewGaugeFunc creates a gauge whose value is read from fn on every scrape.
+func NewGaugeFunc(name string, help string, fn ValueFunc) Collector {
+	return funcCollector{desc: description{name: name, help: help, kind: "gauge"}, fn: fn}
+}
+
+// NewCounterFunc creates a counter whose value is read from fn on every scrape. fn must never
+// return less than it did before.
+func NewCounterFunc(name string, help string, fn ValueFunc) Collector {
+	return funcCollector{desc: description{name: name, help: help, kind: "counter"}, fn: fn}
+}
+
+func (collector funcCollector) describe() description {
+	return collector.desc
+}
+
+func (collector funcCollector) write(ctx context.Context, w io.Writer) error {
+	value, err := collector.fn(ctx)
+	if err != nil {
+		return err
+	}
+	writeSample(w, collector.desc.name, nil, nil, value)
+	return nil
+}
+
+func writeSample(w io.Writer, name string, labelNames []string, labelValues []string, value float64) {
+	io.WriteString(w, name)
+	if len(labelNames) > 0 {
+		io.WriteString(w, "{")
+		for i, labelName := range labelNames {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", labelName, escapeLabelValue(labelValues[i]))
+		}
+		io.WriteString(w, "}")
+	}
+	fmt.Fprintf(w, " %s\n", formatFloat(value))
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+// sortedKeys keeps the output stable between scrapes, which makes it easier to read and test.
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
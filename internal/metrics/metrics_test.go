@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	requests := NewCounterVec("requests_total", "Requests served.", "route", "status")
+	requests.Inc("GET /rooms", "200")
+	requests.Inc("GET /rooms", "200")
+	requests.Add(3, `GET /"odd"`, "500")
+
+	duration := NewHistogramVec("request_duration_seconds", "Request latency.", []float64{0.1, 1}, "route")
+	duration.Observe(0.05, "GET /rooms")
+	duration.Observe(0.1, "GET /rooms")
+	duration.Observe(2, "GET /rooms")
+
+	clients := NewGaugeFunc("clients", "Connected clients.", func(ctx context.Context) (float64, error) {
+		return 7, nil
+	})
+	broken := NewGaugeFunc("broken", "Always fails.", func(ctx context.Context) (float64, error) {
+		return 0, errors.New("source is down")
+	})
+
+	registry := NewRegistry()
+	registry.Register(requests, duration, clients, broken)
+
+	var buf bytes.Buffer
+	err := registry.WriteTo(context.Background(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="GET /\"odd\"",status="500"} 3
+requests_total{route="GET /rooms",status="200"} 2
+# HELP request_duration_seconds Request latency.
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{route="GET /rooms",le="0.1"} 2
+request_duration_seconds_bucket{route="GET /rooms",le="1"} 2
+request_duration_seconds_bucket{route="GET /rooms",le="+Inf"} 3
+request_duration_seconds_sum{route="GET /rooms"} 2.15
+request_duration_seconds_count{route="GET /rooms"} 3
+# HELP clients Connected clients.
+# TYPE clients gauge
+clients 7
+# HELP broken Always fails.
+# TYPE broken gauge
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestCounterVecPanicsOnWrongLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc with the wrong number of labels did not panic")
+		}
+	}()
+	NewCounterVec("requests_total", "Requests served.", "route").Inc("GET /", "200")
+}
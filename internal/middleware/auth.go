@@ -5,42 +5,72 @@ package middleware
 import (
 	"context"
 	"errors"
-	"log"
 	"net/http"
 
+	"gochat/main/internal/application"
+	"gochat/main/internal/logging"
 	"gochat/main/internal/store"
 	"gochat/main/internal/utils/sessions"
-
-	"github.com/jackc/pgx/v5"
 )
 
 // AuthMiddleware populates the User struct if the request contains a valid session id.
-func AuthMiddleware(next http.Handler, userService store.UserService) http.Handler {
+// Sessions in use are renewed according to the policy, at most once per renew interval.
+func AuthMiddleware(next http.Handler, app *application.App) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		sessionCookie, err := r.Cookie(sessions.SessionCookieName)
+		sessionCookie, err := r.Cookie(sessions.CookieName())
 		if err != nil {
 			if !errors.Is(err, http.ErrNoCookie) {
-				log.Printf("Error when retrieving session id from cookie: %v", err)
+				app.Logger.ErrorContext(r.Context(), "Error retrieving session id from cookie", "err", err)
 			}
 
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		user, err := userService.GetUserFromSessionID(r.Context(), sessionCookie.Value)
+		session, err := app.Sessions.GetSession(r.Context(), sessionCookie.Value)
 		if err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
+			if errors.Is(err, store.ErrSessionNotFound) {
 				// The session is likely invalidated or expired.
 				clearSessionCookie := sessions.CreateClearSessionCookie()
 				http.SetCookie(w, &clearSessionCookie)
 			} else {
-				log.Printf("Error when getting user from session: %v", err)
+				app.Logger.ErrorContext(r.Context(), "Error getting session", "err", err)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := app.Users.GetUserByID(r.Context(), session.UserID)
+		if err != nil {
+			if errors.Is(err, store.ErrUserNotFound) {
+				// The user has been deactivated since the session was created.
+				clearSessionCookie := sessions.CreateClearSessionCookie()
+				http.SetCookie(w, &clearSessionCookie)
+			} else {
+				app.Logger.ErrorContext(r.Context(), "Error getting user from session", "err", err)
 			}
 			next.ServeHTTP(w, r)
 			return
 		}
 
+		logging.SetUserID(r.Context(), user.ID)
+
+		now := app.Clock.Now()
+		if app.SessionPolicy.ShouldRenew(session.LastSeenAt, now) {
+			expiresAt := app.SessionPolicy.ExpiresAt(session.CreatedAt, now)
+
+			err = app.Sessions.TouchSession(r.Context(), sessionCookie.Value, now, expiresAt)
+			if err != nil {
+				// The session is still valid until its current expiry, so carry on with it.
+				app.Logger.ErrorContext(r.Context(), "Error renewing session", "err", err)
+			} else {
+				renewedSessionCookie := sessions.NewSessionCookie(sessionCookie.Value, expiresAt)
+				http.SetCookie(w, &renewedSessionCookie)
+			}
+		}
+
 		ctxWithUser := context.WithValue(r.Context(), sessions.UserContextKey, user)
-		next.ServeHTTP(w, r.WithContext(ctxWithUser))
+		ctxWithSession := context.WithValue(ctxWithUser, sessions.SessionContextKey, session)
+		next.ServeHTTP(w, r.WithContext(ctxWithSession))
 	})
 }
@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/models"
+	"gochat/main/internal/store"
+	"gochat/main/internal/store/storetest"
+	"gochat/main/internal/utils/sessions"
+)
+
+// failingSessionStore is a session store whose lookups fail, like a database which is down.
+type failingSessionStore struct {
+	store.SessionStore
+}
+
+func (failingSessionStore) GetSession(ctx context.Context, sessionID string) (models.Session, error) {
+	return models.Session{}, errors.New("session store is down")
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	const sessionID = "session-id"
+	policy := sessions.Policy{
+		IdleTimeout:      time.Hour,
+		AbsoluteLifetime: 24 * time.Hour,
+		RenewInterval:    time.Minute,
+	}
+
+	tests := []struct {
+		name string
+		// cookie is the session id sent with the request, if any.
+		cookie string
+		// lastSeen is how long ago the session was last renewed.
+		lastSeen        time.Duration
+		expired         bool
+		deactivated     bool
+		failingSessions bool
+		wantUser        bool
+		wantClearCookie bool
+		wantRenewal     bool
+	}{
+		{
+			name: "passes through without a cookie",
+		},
+		{
+			name:     "attaches the user for a valid session",
+			cookie:   sessionID,
+			wantUser: true,
+		},
+		{
+			name:        "renews a session due for renewal",
+			cookie:      sessionID,
+			lastSeen:    2 * time.Minute,
+			wantUser:    true,
+			wantRenewal: true,
+		},
+		{
+			name:            "clears an unknown session",
+			cookie:          "unknown-session-id",
+			wantClearCookie: true,
+		},
+		{
+			name:            "clears an expired session",
+			cookie:          sessionID,
+			expired:         true,
+			wantClearCookie: true,
+		},
+		{
+			name:            "clears the session of a deactivated user",
+			cookie:          sessionID,
+			deactivated:     true,
+			wantClearCookie: true,
+		},
+		{
+			name:            "keeps the cookie when the session store fails",
+			cookie:          sessionID,
+			failingSessions: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userStore := storetest.NewUserStore()
+			bob := userStore.AddUser("bob", "password123")
+			if test.deactivated {
+				userStore.Deactivate(bob.ID)
+			}
+
+			memorySessionStore := store.NewMemorySessionStore()
+			var sessionStore store.SessionStore = memorySessionStore
+			if test.failingSessions {
+				sessionStore = failingSessionStore{memorySessionStore}
+			}
+
+			now := time.Now()
+			expiresAt := now.Add(policy.IdleTimeout)
+			if test.expired {
+				expiresAt = now.Add(-time.Minute)
+			}
+			_, err := memorySessionStore.CreateSession(context.Background(), sessionID, bob.ID, expiresAt, models.SessionMetadata{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.lastSeen > 0 && !test.expired {
+				err = memorySessionStore.TouchSession(context.Background(), sessionID, now.Add(-test.lastSeen), expiresAt)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var gotUser store.User
+			var gotSession models.Session
+			var hasUser, hasSession bool
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUser, hasUser = r.Context().Value(sessions.UserContextKey).(store.User)
+				gotSession, hasSession = r.Context().Value(sessions.SessionContextKey).(models.Session)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: sessions.CookieName(), Value: test.cookie})
+			}
+			w := httptest.NewRecorder()
+			app := &application.App{
+				Logger:        slog.New(slog.DiscardHandler),
+				Clock:         application.SystemClock,
+				Users:         userStore,
+				Sessions:      sessionStore,
+				SessionPolicy: policy,
+			}
+			AuthMiddleware(next, app).ServeHTTP(w, r)
+
+			if hasUser != test.wantUser || hasSession != test.wantUser {
+				t.Fatalf("user attached = %t, session attached = %t, want %t", hasUser, hasSession, test.wantUser)
+			}
+			if test.wantUser && (gotUser.ID != bob.ID || gotSession.UserID != bob.ID) {
+				t.Errorf("attached user %d and session for user %d, want %d", gotUser.ID, gotSession.UserID, bob.ID)
+			}
+
+			var cookie *http.Cookie
+			for _, responseCookie := range w.Result().Cookies() {
+				if responseCookie.Name == sessions.CookieName() {
+					cookie = responseCookie
+				}
+			}
+
+			switch {
+			case test.wantClearCookie:
+				if cookie == nil || cookie.MaxAge >= 0 {
+					t.Errorf("cookie = %+v, want it cleared", cookie)
+				}
+			case test.wantRenewal:
+				if cookie == nil || cookie.Value != sessionID || !cookie.Expires.After(now) {
+					t.Errorf("cookie = %+v, want it reissued with a new expiry", cookie)
+				}
+				session, err := memorySessionStore.GetSession(context.Background(), sessionID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if session.LastSeenAt.Before(now) {
+					t.Errorf("session last seen at %v, want it renewed", session.LastSeenAt)
+				}
+			default:
+				if cookie != nil {
+					t.Errorf("cookie = %+v, want none set", cookie)
+				}
+			}
+		})
+	}
+}
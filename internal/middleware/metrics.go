@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/logging"
+)
+
+// unmatchedRoute labels requests no route matched, so scanners probing random paths can not
+// create a series per path.
+const unmatchedRoute = "unmatched"
+
+// MetricsMiddleware counts and times requests by the route which served them. It relies on
+// RouteMiddleware running inside it to record the route.
+func MetricsMiddleware(next http.Handler, app *application.App) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := app.Clock.Now()
+		rw := newResponseWriter(w)
+
+		next.ServeHTTP(rw, r)
+
+		route := logging.Route(r.Context())
+		if route == "" {
+			route = unmatchedRoute
+		}
+		app.Metrics.HTTPRequests.Inc(route, r.Method, strconv.Itoa(rw.Status()))
+		// A websocket lasts as long as the user stays, which would swamp the latencies.
+		if !rw.hijacked {
+			app.Metrics.HTTPRequestDuration.Observe(app.Clock.Now().Sub(start).Seconds(), route)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"gochat/main/internal/application"
+	"gochat/main/internal/utils/responses"
+)
+
+// RecoveryMiddleware turns a panicking handler into a logged stack trace and an error page, rather
+// than the connection being dropped with nothing recorded. A handler panicking with
+// http.ErrAbortHandler wants the connection dropped, so that panic is passed on.
+func RecoveryMiddleware(next http.Handler, app *application.App) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := newResponseWriter(w)
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			app.Logger.ErrorContext(r.Context(), "Handler panicked", "panic", recovered, "stack", string(debug.Stack()))
+
+			// Once the response has started there is no way to replace it with the error page,
+			// so drop the connection and let the client see the response was cut short.
+			if rw.status != 0 || rw.hijacked {
+				panic(http.ErrAbortHandler)
+			}
+
+			responses.RenderInternalErrorOnTemplate(w, r, app.Templates, "error.html", map[string]any{})
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// AccessLogMiddleware logs a line for every request once it has been served.
+func AccessLogMiddleware(next http.Handler, app *application.App) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := app.Clock.Now()
+		rw := newResponseWriter(w)
+
+		// Deferred so requests aborted by a panic are logged too.
+		defer func() {
+			recovered := recover()
+			app.Logger.InfoContext(r.Context(), "Request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rw.Status(),
+				"bytes", rw.bytes,
+				"latency", app.Clock.Now().Sub(start).Round(time.Microsecond),
+				"aborted", recovered != nil,
+			)
+			if recovered != nil {
+				panic(recovered)
+			}
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
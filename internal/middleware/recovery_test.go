@@ -0,0 +1,233 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gochat/main/internal/application"
+)
+
+func newTestApp(t *testing.T, logger *slog.Logger) *application.App {
+	t.Helper()
+	templates, err := template.ParseGlob("../../templates/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &application.App{
+		Logger:    logger,
+		Templates: templates,
+		Clock:     application.SystemClock,
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		wantStatus  int
+		wantBody    string
+		wantRepanic any
+	}{
+		{
+			name: "leaves a working handler alone",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hello"))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "hello",
+		},
+		{
+			name: "renders the error page for a panic",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic("boom")
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   "An internal error occured.",
+		},
+		{
+			name: "aborts a response which has already started",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("partial"))
+				panic("boom")
+			},
+			wantRepanic: http.ErrAbortHandler,
+		},
+		{
+			name: "aborts a response whose header has been written",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				panic("boom")
+			},
+			wantRepanic: http.ErrAbortHandler,
+		},
+		{
+			name: "passes on an abort",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic(http.ErrAbortHandler)
+			},
+			wantRepanic: http.ErrAbortHandler,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApp(t, slog.New(slog.DiscardHandler))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			w := httptest.NewRecorder()
+
+			var repanic any
+			func() {
+				defer func() { repanic = recover() }()
+				RecoveryMiddleware(test.handler, app).ServeHTTP(w, r)
+			}()
+
+			if repanic != test.wantRepanic {
+				t.Fatalf("panic = %v, want %v", repanic, test.wantRepanic)
+			}
+			if test.wantRepanic != nil {
+				return
+			}
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), test.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", w.Body.String(), test.wantBody)
+			}
+		})
+	}
+}
+
+// headerRecorder fails the test if the header is written more than once, which the server would
+// ignore with a "superfluous WriteHeader" warning.
+type headerRecorder struct {
+	*httptest.ResponseRecorder
+	t       *testing.T
+	written bool
+}
+
+func (recorder *headerRecorder) WriteHeader(status int) {
+	if recorder.written {
+		recorder.t.Errorf("WriteHeader(%d) called after the header was written", status)
+	}
+	recorder.written = true
+	recorder.ResponseRecorder.WriteHeader(status)
+}
+
+func (recorder *headerRecorder) Write(b []byte) (int, error) {
+	recorder.written = true
+	return recorder.ResponseRecorder.Write(b)
+}
+
+func TestRecoveryMiddlewareWritesHeaderOnce(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates *template.Template
+	}{
+		{
+			name: "with the error page",
+		},
+		{
+			name:      "when the error page fails to render",
+			templates: template.Must(template.New("error.html").Parse(`{{template "missing"}}`)),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApp(t, slog.New(slog.DiscardHandler))
+			if test.templates != nil {
+				app.Templates = test.templates
+			}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			w := &headerRecorder{ResponseRecorder: httptest.NewRecorder(), t: t}
+
+			RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("boom")
+			}), app).ServeHTTP(w, r)
+
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+			}
+		})
+	}
+}
+
+// hijackableRecorder is a recorder which can be hijacked, like the server's response writer.
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (recorder *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	recorder.hijacked = true
+	return nil, nil, nil
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantBytes  int64
+	}{
+		{
+			name: "records an implicit 200",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hello"))
+			},
+			wantStatus: http.StatusOK,
+			wantBytes:  5,
+		},
+		{
+			name: "records the status written",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.NotFound(w, r)
+			},
+			wantStatus: http.StatusNotFound,
+			wantBytes:  int64(len("404 page not found\n")),
+		},
+		{
+			name: "passes hijacking through",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _, err := http.NewResponseController(w).Hijack()
+				if err != nil {
+					t.Errorf("hijack failed: %v", err)
+				}
+			},
+			wantStatus: http.StatusSwitchingProtocols,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			app := newTestApp(t, slog.New(slog.NewJSONHandler(&buf, nil)))
+			r := httptest.NewRequest(http.MethodGet, "/rooms", nil)
+			w := &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+			AccessLogMiddleware(test.handler, app).ServeHTTP(w, r)
+
+			var line struct {
+				Method string `json:"method"`
+				Path   string `json:"path"`
+				Status int    `json:"status"`
+				Bytes  int64  `json:"bytes"`
+			}
+			err := json.Unmarshal(buf.Bytes(), &line)
+			if err != nil {
+				t.Fatalf("log line %q is not JSON: %v", buf.String(), err)
+			}
+			if line.Method != http.MethodGet || line.Path != "/rooms" || line.Status != test.wantStatus || line.Bytes != test.wantBytes {
+				t.Errorf("log line = %+v, want GET /rooms with status %d and %d bytes", line, test.wantStatus, test.wantBytes)
+			}
+		})
+	}
+}
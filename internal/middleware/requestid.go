@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"gochat/main/internal/logging"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request ids accepted from a proxy, since they end up in every log line.
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware tags the request with an id, which is logged with everything done for the
+// request and returned in the X-Request-ID header. An id set by a proxy in front is kept so the
+// logs of both can be matched up.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = generateRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		ctx := logging.WithRequestID(r.Context(), requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func generateRequestID() string {
+	bytes := make([]byte, 16)
+	// rand.Read never returns an error.
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// isValidRequestID allows ids made of letters, digits and a little punctuation, which covers
+// UUIDs and the formats proxies generate without letting anything odd into the logs.
+func isValidRequestID(requestID string) bool {
+	if len(requestID) == 0 || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		isAllowed := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.'
+		if !isAllowed {
+			return false
+		}
+	}
+	return true
+}
+
+// RouteMiddleware records the pattern of the route matching the request, so log lines can be
+// grouped by route rather than by every distinct path.
+func RouteMiddleware(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		logging.SetRoute(r.Context(), pattern)
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gochat/main/internal/logging"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		wantKept bool
+	}{
+		{
+			name: "generates an id",
+		},
+		{
+			name:     "keeps a valid incoming id",
+			incoming: "3f2c9a1e-proxy.7",
+			wantKept: true,
+		},
+		{
+			name:     "replaces an id with odd characters",
+			incoming: "id\" injected=\"1",
+		},
+		{
+			name:     "replaces an overly long id",
+			incoming: strings.Repeat("a", maxRequestIDLength+1),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var contextID string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contextID = logging.RequestID(r.Context())
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.incoming != "" {
+				r.Header.Set(RequestIDHeader, test.incoming)
+			}
+			w := httptest.NewRecorder()
+			RequestIDMiddleware(next).ServeHTTP(w, r)
+
+			headerID := w.Header().Get(RequestIDHeader)
+			if headerID == "" || headerID != contextID {
+				t.Fatalf("header id = %q, context id = %q, want the same non-empty id", headerID, contextID)
+			}
+			if (headerID == test.incoming) != test.wantKept {
+				t.Errorf("id = %q, incoming %q, want kept %t", headerID, test.incoming, test.wantKept)
+			}
+		})
+	}
+}
+
+func TestRequestLogLinesCarryRequestFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.NewLogger(&buf, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logging.SetUserID(r.Context(), 42)
+		logger.InfoContext(r.Context(), "Viewed room")
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/rooms/7", nil)
+	r.Header.Set(RequestIDHeader, "request-1")
+	RequestIDMiddleware(RouteMiddleware(mux)).ServeHTTP(httptest.NewRecorder(), r)
+
+	var line struct {
+		Msg       string `json:"msg"`
+		RequestID string `json:"request_id"`
+		UserID    int64  `json:"user_id"`
+		Route     string `json:"route"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &line)
+	if err != nil {
+		t.Fatalf("log line %q is not JSON: %v", buf.String(), err)
+	}
+	if line.Msg != "Viewed room" || line.RequestID != "request-1" || line.UserID != 42 || line.Route != "GET /rooms/{id}" {
+		t.Errorf("log line = %+v, want the request id, user id and route", line)
+	}
+}
@@ -0,0 +1,399 @@
+// Package migrations applies the database schema, which is embedded in the binary.
+//
+// Each migration is a pair of files in sql/ named NNN_description.up.sql and
+// NNN_description.down.sql, where NNN is its version. Applied versions are recorded in the
+// schema_migrations table.
+package migrations
+
+import (
+	"cmp"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockID is the Postgres advisory lock held while migrating, so two servers starting at once do
+// not both try to apply the same migration.
+const lockID int64 = 0x676f63686174 // "gochat"
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration known to the binary or recorded in the database, or both.
+type MigrationStatus struct {
+	Version int64
+	Name    string
+	// AppliedAt is nil if the migration has not been applied.
+	AppliedAt *time.Time
+	// IsUnknown is set for migrations recorded in the database which this binary does not have,
+	// meaning the database was migrated by a newer version.
+	IsUnknown bool
+}
+
+// Migrator applies the embedded migrations to a database.
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+}
+
+func NewMigrator(db *pgxpool.Pool) (Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return Migrator{}, err
+	}
+
+	return Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// load reads the migrations from the sql directory, ordered by version.
+func load(fsys fs.FS) ([]Migration, error) {
+	paths, err := fs.Glob(fsys, "sql/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, filePath := range paths {
+		fileName := path.Base(filePath)
+
+		base, direction, ok := strings.Cut(strings.TrimSuffix(fileName, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", fileName)
+		}
+
+		versionText, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s must be named NNN_description", fileName)
+		}
+		version, err := strconv.ParseInt(versionText, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s does not start with a positive version", fileName)
+		}
+
+		contents, err := fs.ReadFile(fsys, filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has files with different names: %s and %s", version, migration.Name, name)
+		}
+
+		script := &migration.Up
+		if direction == "down" {
+			script = &migration.Down
+		}
+		// Versions written differently, like 1 and 001, would otherwise quietly replace each other.
+		if *script != "" {
+			return nil, fmt.Errorf("migration %d has more than one %s file", version, direction)
+		}
+		*script = string(contents)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
+
+// Status lists every migration in version order along with when it was applied.
+func (migrator *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := appliedMigrations(ctx, migrator.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range migrator.migrations {
+		status := MigrationStatus{
+			Version: migration.Version,
+			Name:    migration.Name,
+		}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	for version, appliedAt := range applied {
+		statuses = append(statuses, MigrationStatus{
+			Version:   version,
+			AppliedAt: &appliedAt,
+			IsUnknown: true,
+		})
+	}
+
+	slices.SortFunc(statuses, func(a, b MigrationStatus) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return statuses, nil
+}
+
+// Pending returns the migrations which have not been applied yet, in the order they will be.
+func (migrator *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := appliedMigrations(ctx, migrator.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range migrator.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration and returns the ones it applied.
+// Each migration runs in its own transaction, so a failure leaves the earlier ones applied.
+func (migrator *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var migrated []Migration
+
+	err := migrator.withLock(ctx, func(conn *pgxpool.Conn) error {
+		// Look again now the lock is held in case another server just migrated.
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrator.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				// Without arguments pgx uses the simple protocol, which allows several statements.
+				_, err := tx.Exec(ctx, migration.Up)
+				if err != nil {
+					return err
+				}
+
+				recordMigrationQuery := `
+				INSERT INTO schema_migrations (version, name)
+				VALUES ($1, $2)`
+
+				_, err = tx.Exec(ctx, recordMigrationQuery, migration.Version, migration.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("applying migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			migrated = append(migrated, migration)
+		}
+		return nil
+	})
+	return migrated, err
+}
+
+// Down reverts the most recently applied steps migrations and returns the ones it reverted.
+func (migrator *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := migrator.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		versions := make([]int64, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		slices.Sort(versions)
+		slices.Reverse(versions)
+
+		for _, version := range versions[:min(steps, len(versions))] {
+			index := slices.IndexFunc(migrator.migrations, func(migration Migration) bool {
+				return migration.Version == version
+			})
+			if index == -1 {
+				return fmt.Errorf("migration %d was applied by a newer version and can not be reverted by this one", version)
+			}
+			migration := migrator.migrations[index]
+
+			err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, migration.Down)
+				if err != nil {
+					return err
+				}
+
+				forgetMigrationQuery := `
+				DELETE FROM schema_migrations
+				WHERE version = $1`
+
+				_, err = tx.Exec(ctx, forgetMigrationQuery, migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Baseline records every migration up to and including version as applied without running it.
+// It is for databases whose schema was created by hand before migrations were tracked.
+func (migrator *Migrator) Baseline(ctx context.Context, version int64) ([]Migration, error) {
+	if !slices.ContainsFunc(migrator.migrations, func(migration Migration) bool {
+		return migration.Version == version
+	}) {
+		return nil, fmt.Errorf("there is no migration %d", version)
+	}
+
+	var recorded []Migration
+	err := migrator.withLock(ctx, func(conn *pgxpool.Conn) error {
+		recordMigrationQuery := `
+		INSERT INTO schema_migrations (version, name)
+		VALUES ($1, $2)
+		ON CONFLICT (version) DO NOTHING`
+
+		for _, migration := range migrator.migrations {
+			if migration.Version > version {
+				break
+			}
+
+			tag, err := conn.Exec(ctx, recordMigrationQuery, migration.Version, migration.Name)
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() > 0 {
+				recorded = append(recorded, migration)
+			}
+		}
+		return nil
+	})
+	return recorded, err
+}
+
+// withLock runs fn on a single connection holding the migration lock, creating the
+// schema_migrations table first if needed.
+func (migrator *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := migrator.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	// Session level advisory locks belong to the connection, so everything has to happen on it.
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockID)
+	if err != nil {
+		return fmt.Errorf("taking migration lock: %w", err)
+	}
+	defer func() {
+		// Use a fresh context so the lock is released even if ctx was cancelled.
+		_, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+		if err != nil {
+			// Closing the connection drops the lock with it.
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	createMigrationsTableQuery := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+	    version BIGINT PRIMARY KEY,
+	    name TEXT NOT NULL,
+	    applied_at TIMESTAMP DEFAULT NOW() NOT NULL
+	)`
+
+	_, err = conn.Exec(ctx, createMigrationsTableQuery)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// appliedMigrations returns when each applied version was applied. A database which has never been
+// migrated has no schema_migrations table, which counts as nothing applied.
+func appliedMigrations(ctx context.Context, db querier) (map[int64]time.Time, error) {
+	var hasTable bool
+	err := db.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&hasTable)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]time.Time)
+	if !hasTable {
+		return applied, nil
+	}
+
+	rows, err := db.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var version int64
+	var appliedAt time.Time
+	_, err = pgx.ForEachRow(rows, []any{&version, &appliedAt}, func() error {
+		applied[version] = appliedAt
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// ErrSchemaBehind is returned by CheckCurrent when there are migrations still to apply.
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// CheckCurrent returns ErrSchemaBehind, wrapped with the pending versions, unless every migration
+// has been applied.
+func (migrator *Migrator) CheckCurrent(ctx context.Context) error {
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	versions := make([]string, len(pending))
+	for i, migration := range pending {
+		versions[i] = fmt.Sprintf("%d_%s", migration.Version, migration.Name)
+	}
+	return fmt.Errorf("%w, pending migrations: %s", ErrSchemaBehind, strings.Join(versions, ", "))
+}
@@ -0,0 +1,161 @@
+package migrations
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestLoadEmbeddedMigrations(t *testing.T) {
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i, migration := range migrations {
+		// Versions are numbered from 1 without gaps, so a missing file shows up here.
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %d has version %d, want %d", i, migration.Version, i+1)
+		}
+		if strings.TrimSpace(migration.Up) == "" || strings.TrimSpace(migration.Down) == "" {
+			t.Errorf("migration %d_%s has an empty up or down file", migration.Version, migration.Name)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := &fstest.MapFile{Data: []byte("SELECT 1;")}
+
+	tests := []struct {
+		name         string
+		files        []string
+		wantVersions []int64
+		wantErr      string
+	}{
+		{
+			name:         "orders by version rather than name",
+			files:        []string{"10_ten.up.sql", "10_ten.down.sql", "9_nine.up.sql", "9_nine.down.sql", "002_two.up.sql", "002_two.down.sql"},
+			wantVersions: []int64{2, 9, 10},
+		},
+		{
+			name:    "rejects a version written twice",
+			files:   []string{"1_one.up.sql", "1_one.down.sql", "001_one.up.sql"},
+			wantErr: "migration 1 has more than one up file",
+		},
+		{
+			name:    "rejects files with different names for a version",
+			files:   []string{"001_one.up.sql", "001_uno.down.sql"},
+			wantErr: "migration 1 has files with different names",
+		},
+		{
+			name:    "rejects a missing down file",
+			files:   []string{"001_one.up.sql"},
+			wantErr: "migration 1_one needs both an up and a down file",
+		},
+		{
+			name:    "rejects a file without a direction",
+			files:   []string{"001_one.sql"},
+			wantErr: "must end in .up.sql or .down.sql",
+		},
+		{
+			name:    "rejects a file without a description",
+			files:   []string{"001.up.sql"},
+			wantErr: "must be named NNN_description",
+		},
+		{
+			name:    "rejects a version which is not a number",
+			files:   []string{"one_first.up.sql"},
+			wantErr: "does not start with a positive version",
+		},
+		{
+			name:    "rejects version zero",
+			files:   []string{"000_zero.up.sql"},
+			wantErr: "does not start with a positive version",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, name := range test.files {
+				fsys["sql/"+name] = file
+			}
+
+			migrations, err := load(fsys)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var versions []int64
+			for _, migration := range migrations {
+				versions = append(versions, migration.Version)
+			}
+			if !slices.Equal(versions, test.wantVersions) {
+				t.Errorf("versions = %v, want %v", versions, test.wantVersions)
+			}
+		})
+	}
+}
+
+// testDatabaseURLEnv names the database to migrate, and the test using it is skipped when it is
+// unset. It is the same database the store tests use, so it must never hold real data.
+const testDatabaseURLEnv = "GOCHAT_TEST_DATABASE_URL"
+
+func TestUpIsIdempotent(t *testing.T) {
+	url := os.Getenv(testDatabaseURLEnv)
+	if url == "" {
+		t.Skipf("%s is not set", testDatabaseURLEnv)
+	}
+
+	ctx := context.Background()
+	db, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = migrator.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("migrating again: %v", err)
+	}
+	if len(migrated) != 0 {
+		t.Errorf("migrating again applied %d migrations, want none", len(migrated))
+	}
+	err = migrator.CheckCurrent(ctx)
+	if err != nil {
+		t.Errorf("CheckCurrent = %v, want the schema to be current", err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil || status.IsUnknown {
+			t.Errorf("migration %d_%s is not recorded as applied", status.Version, status.Name)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+-- Messages from every room end up back in the single global room.
+DROP INDEX messages_room_id_id_idx;
+ALTER TABLE messages DROP COLUMN room_id;
+
+DROP TABLE room_members;
+DROP TABLE rooms;
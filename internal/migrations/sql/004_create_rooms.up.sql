@@ -0,0 +1,26 @@
+CREATE TABLE rooms (
+  id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  name VARCHAR(50) NOT NULL UNIQUE,
+  created_by BIGINT REFERENCES users(id),
+  created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+  archived_at TIMESTAMP
+);
+
+CREATE TABLE room_members (
+  room_id BIGINT REFERENCES rooms(id) NOT NULL,
+  user_id BIGINT REFERENCES users(id) NOT NULL,
+  joined_at TIMESTAMP DEFAULT NOW() NOT NULL,
+  PRIMARY KEY (room_id, user_id)
+);
+
+-- The original global room lives on as "general" and keeps its history and users.
+INSERT INTO rooms (name) VALUES ('general');
+
+INSERT INTO room_members (room_id, user_id)
+SELECT r.id, u.id FROM rooms r CROSS JOIN users u WHERE r.name = 'general';
+
+ALTER TABLE messages ADD COLUMN room_id BIGINT REFERENCES rooms(id);
+UPDATE messages SET room_id = (SELECT id FROM rooms WHERE name = 'general');
+ALTER TABLE messages ALTER COLUMN room_id SET NOT NULL;
+
+CREATE INDEX messages_room_id_id_idx ON messages (room_id, id);
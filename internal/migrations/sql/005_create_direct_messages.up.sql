@@ -0,0 +1,17 @@
+CREATE TABLE direct_messages (
+  id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  sender_id BIGINT REFERENCES users(id) NOT NULL,
+  recipient_id BIGINT REFERENCES users(id) NOT NULL,
+  body TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+  read_at TIMESTAMP,
+  CHECK (sender_id <> recipient_id)
+);
+
+-- A conversation is keyed on the unordered pair of its two participants.
+CREATE INDEX direct_messages_conversation_idx
+  ON direct_messages (LEAST(sender_id, recipient_id), GREATEST(sender_id, recipient_id), id);
+
+CREATE INDEX direct_messages_unread_idx
+  ON direct_messages (recipient_id, sender_id)
+  WHERE read_at IS NULL;
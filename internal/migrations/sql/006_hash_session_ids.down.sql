@@ -0,0 +1,6 @@
+-- The hashes can not be turned back into session ids, so everyone is signed out.
+DELETE FROM sessions;
+
+ALTER TABLE sessions ALTER COLUMN session_id_hash TYPE VARCHAR(255);
+
+ALTER TABLE sessions RENAME COLUMN session_id_hash TO session_id;
@@ -0,0 +1,7 @@
+-- Session ids are stored as the hex encoded SHA-256 of the cookie value so a leaked
+-- table can not be used to hijack sessions.
+ALTER TABLE sessions RENAME COLUMN session_id TO session_id_hash;
+
+UPDATE sessions SET session_id_hash = encode(sha256(convert_to(session_id_hash, 'UTF8')), 'hex');
+
+ALTER TABLE sessions ALTER COLUMN session_id_hash TYPE CHAR(64);
@@ -0,0 +1,2 @@
+-- Sessions slide forward while in use, last_seen_at records when one was last extended.
+ALTER TABLE sessions ADD COLUMN last_seen_at TIMESTAMP DEFAULT NOW() NOT NULL;
@@ -0,0 +1,2 @@
+-- Lets the session sweeper find expired sessions without scanning the table.
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
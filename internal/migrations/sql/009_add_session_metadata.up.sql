@@ -0,0 +1,6 @@
+-- Lets users recognise their sessions on the active sessions page.
+ALTER TABLE sessions
+  ADD COLUMN user_agent VARCHAR(512) NOT NULL DEFAULT '',
+  ADD COLUMN ip_address VARCHAR(45) NOT NULL DEFAULT '';
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE users
+  DROP COLUMN failed_login_count,
+  DROP COLUMN locked_until;
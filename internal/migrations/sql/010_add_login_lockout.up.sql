@@ -0,0 +1,4 @@
+-- Consecutive failed sign ins, which lock the account for longer each time past a threshold.
+ALTER TABLE users
+  ADD COLUMN failed_login_count INT NOT NULL DEFAULT 0,
+  ADD COLUMN locked_until TIMESTAMP;
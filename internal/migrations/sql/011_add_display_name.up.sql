@@ -0,0 +1,3 @@
+-- The name shown for the user, empty to show their username.
+ALTER TABLE users
+  ADD COLUMN display_name VARCHAR(50) NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+DROP TABLE password_reset_tokens;
+
+DROP INDEX users_email_idx;
+
+ALTER TABLE users
+  DROP COLUMN email;
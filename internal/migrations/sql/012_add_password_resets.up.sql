@@ -0,0 +1,16 @@
+-- Where password reset links are sent. Optional, but unique regardless of case when given.
+ALTER TABLE users
+  ADD COLUMN email VARCHAR(254);
+
+CREATE UNIQUE INDEX users_email_idx ON users (lower(email));
+
+-- Tokens are stored as the hex encoded SHA-256 of the emailed value, like session ids, and are
+-- deleted once used.
+CREATE TABLE password_reset_tokens (
+  token_hash CHAR(64) NOT NULL PRIMARY KEY,
+  user_id BIGINT REFERENCES users(id) NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX password_reset_tokens_user_id_idx ON password_reset_tokens (user_id);
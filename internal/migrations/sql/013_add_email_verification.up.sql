@@ -0,0 +1,16 @@
+-- When the user proved they own their email, NULL until they follow the emailed link. Changing the
+-- email clears it.
+ALTER TABLE users
+  ADD COLUMN email_verified_at TIMESTAMP;
+
+-- Tokens are stored hashed like password reset tokens. The email they were sent to is kept, so a
+-- link sent before the email changed can not verify the new one.
+CREATE TABLE email_verification_tokens (
+  token_hash CHAR(64) NOT NULL PRIMARY KEY,
+  user_id BIGINT REFERENCES users(id) NOT NULL,
+  email VARCHAR(254) NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX email_verification_tokens_user_id_idx ON email_verification_tokens (user_id);
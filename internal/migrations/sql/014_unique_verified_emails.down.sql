@@ -0,0 +1,4 @@
+-- Fails if two users have given the same email since, which has to be sorted out by hand.
+DROP INDEX users_verified_email_idx;
+
+CREATE UNIQUE INDEX users_email_idx ON users (lower(email));
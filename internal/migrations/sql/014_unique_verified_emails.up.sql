@@ -0,0 +1,5 @@
+-- Only verified emails are unique. Otherwise anyone could give someone else's email first, and its
+-- owner could never use it.
+DROP INDEX users_email_idx;
+
+CREATE UNIQUE INDEX users_verified_email_idx ON users (lower(email)) WHERE email_verified_at IS NOT NULL;
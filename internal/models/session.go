@@ -5,8 +5,21 @@ import "time"
 // TODO: Move me to store package (in sessions)...
 
 type Session struct {
-	SessionID string
-	UserID    int64
-	ExpiresAt time.Time
-	CreatedAt time.Time
+	// SessionIDHash is the hash of the id in the session cookie, the raw id is never stored.
+	SessionIDHash string
+	UserID        int64
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+	// LastSeenAt is when the session was last renewed, so it lags real activity by up to the renew interval.
+	LastSeenAt time.Time
+	SessionMetadata
 }
+
+// SessionMetadata describes the client which created a session, so users can recognise it.
+type SessionMetadata struct {
+	UserAgent string
+	IPAddress string
+}
+
+// MaxUserAgentLength is the longest user agent stored with a session.
+const MaxUserAgentLength = 512
@@ -0,0 +1,128 @@
+// Package ratelimit limits how often something can be done with token buckets. Each key, such as
+// an IP address, gets a bucket holding up to Burst tokens which refills one token every Interval,
+// and every event takes a token.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit allows Burst events at once, then one event every Interval.
+type Limit struct {
+	Burst    int
+	Interval time.Duration
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed bool
+	// RetryAfter is how long until a token is available, when the event was not allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets, so they can live in memory or be shared between servers.
+type Store interface {
+	// Take takes a token from the key's bucket, if it has one.
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Limiter applies a limit to the keys it is given, such as IP addresses.
+type Limiter struct {
+	store Store
+	// name prefixes the keys, so limiters can share a store.
+	name  string
+	limit Limit
+}
+
+func NewLimiter(store Store, name string, limit Limit) *Limiter {
+	return &Limiter{
+		store: store,
+		name:  name,
+		limit: limit,
+	}
+}
+
+// Allow takes a token for the key.
+func (limiter *Limiter) Allow(ctx context.Context, key string, now time.Time) (Result, error) {
+	return limiter.store.Take(ctx, limiter.name+":"+key, limiter.limit, now)
+}
+
+// sweepInterval is how often the memory store forgets full buckets.
+const sweepInterval = time.Minute
+
+// MemoryStore keeps buckets in memory, so limits are per server and reset on restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	limit     Limit
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]bucket),
+	}
+}
+
+func (store *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.sweep(now)
+
+	current, ok := store.buckets[key]
+	if !ok {
+		current = bucket{tokens: float64(limit.Burst), updatedAt: now}
+	}
+	current.limit = limit
+	current.tokens = current.refilled(now)
+	current.updatedAt = now
+
+	if current.tokens < 1 {
+		store.buckets[key] = current
+		missing := 1 - current.tokens
+		return Result{RetryAfter: time.Duration(math.Ceil(missing * float64(limit.Interval)))}, nil
+	}
+
+	current.tokens--
+	store.buckets[key] = current
+	return Result{Allowed: true}, nil
+}
+
+// sweep drops the buckets which have refilled, since a missing bucket starts out full anyway.
+// Without it every address which ever tried would be kept forever.
+func (store *MemoryStore) sweep(now time.Time) {
+	if now.Sub(store.lastSweep) < sweepInterval {
+		return
+	}
+	store.lastSweep = now
+
+	for key, current := range store.buckets {
+		if current.refilled(now) >= float64(current.limit.Burst) {
+			delete(store.buckets, key)
+		}
+	}
+}
+
+// refilled returns the tokens in the bucket at now, counting those added since it was last updated.
+func (current bucket) refilled(now time.Time) float64 {
+	if current.limit.Interval <= 0 {
+		return float64(current.limit.Burst)
+	}
+	elapsed := now.Sub(current.updatedAt)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	tokens := current.tokens + float64(elapsed)/float64(current.limit.Interval)
+	return math.Min(tokens, float64(current.limit.Burst))
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	limit := Limit{Burst: 3, Interval: time.Minute}
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		// after is when each attempt is made, relative to the start.
+		after          []time.Duration
+		wantAllowed    bool
+		wantRetryAfter time.Duration
+	}{
+		{
+			name:        "allows the burst",
+			after:       []time.Duration{0, 0, 0},
+			wantAllowed: true,
+		},
+		{
+			name:           "refuses past the burst until a token is earned",
+			after:          []time.Duration{0, 0, 0, 15 * time.Second},
+			wantRetryAfter: 45 * time.Second,
+		},
+		{
+			name:        "refills a token each interval",
+			after:       []time.Duration{0, 0, 0, time.Minute},
+			wantAllowed: true,
+		},
+		{
+			name:           "refills no more than the burst",
+			after:          []time.Duration{0, time.Hour, time.Hour, time.Hour, time.Hour},
+			wantRetryAfter: time.Minute,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewLimiter(NewMemoryStore(), "test", limit)
+
+			var result Result
+			for _, after := range test.after {
+				var err error
+				result, err = limiter.Allow(context.Background(), "key", start.Add(after))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if result.Allowed != test.wantAllowed || result.RetryAfter != test.wantRetryAfter {
+				t.Errorf("result = %+v, want allowed %t retry after %s", result, test.wantAllowed, test.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestLimitersSharingAStoreAreSeparate(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Burst: 1, Interval: time.Minute}
+	byIP := NewLimiter(store, "ip", limit)
+	byUsername := NewLimiter(store, "username", limit)
+	now := time.Now()
+
+	for _, limiter := range []*Limiter{byIP, byUsername} {
+		result, err := limiter.Allow(context.Background(), "bob", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed {
+			t.Errorf("%s limiter refused the first attempt", limiter.name)
+		}
+	}
+}
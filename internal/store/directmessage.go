@@ -0,0 +1,213 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DirectMessageStore persists the direct messages between pairs of users.
+type DirectMessageStore interface {
+	CreateDirectMessage(ctx context.Context, senderID int64, recipientID int64, body string) (DirectMessage, error)
+	GetDirectMessages(ctx context.Context, userID int64, otherUserID int64, page MessagePage) ([]DirectMessage, error)
+	MarkConversationRead(ctx context.Context, userID int64, otherUserID int64) error
+	ListConversations(ctx context.Context, userID int64) ([]Conversation, error)
+	GetUnreadCount(ctx context.Context, userID int64) (int64, error)
+}
+
+// DirectMessageService is the Postgres backed DirectMessageStore.
+type DirectMessageService struct {
+	db *pgxpool.Pool
+}
+
+func NewDirectMessageService(db *pgxpool.Pool) DirectMessageService {
+	return DirectMessageService{
+		db: db,
+	}
+}
+
+var _ DirectMessageStore = (*DirectMessageService)(nil)
+
+type DirectMessage struct {
+	ID             int64
+	SenderID       int64
+	SenderUsername string
+	// SenderName is the sender's display name, or their username if they have none.
+	SenderName  string
+	RecipientID int64
+	Body        string
+	CreatedAt   time.Time
+	ReadAt      *time.Time
+}
+
+// Conversation summarises the direct messages between a user and one other user.
+type Conversation struct {
+	OtherUserID   int64
+	OtherUsername string
+	// OtherName is the other user's display name, or their username if they have none.
+	OtherName     string
+	LastMessageAt time.Time
+	UnreadCount   int64
+}
+
+var (
+	ErrRecipientNotFound = errors.New("recipient not found")
+	ErrCannotMessageSelf = errors.New("users can not direct message themselves")
+)
+
+// The participants of a conversation are matched regardless of who sent each message.
+const conversationCondition = `
+    LEAST(d.sender_id, d.recipient_id) = LEAST($1::BIGINT, $2::BIGINT)
+    AND GREATEST(d.sender_id, d.recipient_id) = GREATEST($1::BIGINT, $2::BIGINT)`
+
+// CreateDirectMessage sends the message to the recipient, who must be an active user.
+func (service *DirectMessageService) CreateDirectMessage(ctx context.Context, senderID int64, recipientID int64, body string) (DirectMessage, error) {
+	if senderID == recipientID {
+		return DirectMessage{}, ErrCannotMessageSelf
+	}
+
+	createDirectMessageQuery := `
+    WITH inserted AS (
+        INSERT INTO direct_messages (sender_id, recipient_id, body)
+        SELECT $1, $2, $3
+        WHERE EXISTS (SELECT 1 FROM users WHERE id = $2 AND is_active = true)
+        RETURNING id, sender_id, recipient_id, body, created_at, read_at
+    )
+    SELECT i.id, i.sender_id, u.username, ` + userNameColumn + `, i.recipient_id, i.body, i.created_at, i.read_at
+    FROM inserted i
+    INNER JOIN users u ON u.id = i.sender_id`
+
+	rows, err := service.db.Query(ctx, createDirectMessageQuery, senderID, recipientID, body)
+	if err != nil {
+		return DirectMessage{}, err
+	}
+
+	message, err := pgx.CollectExactlyOneRow(rows, scanDirectMessage)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DirectMessage{}, ErrRecipientNotFound
+	}
+	return message, err
+}
+
+// GetDirectMessages returns a page of the conversation between the two users ordered from oldest to newest.
+// It only ever returns messages the user sent or received.
+func (service *DirectMessageService) GetDirectMessages(ctx context.Context, userID int64, otherUserID int64, page MessagePage) ([]DirectMessage, error) {
+	limit := page.Limit
+	if limit <= 0 {
+		limit = DefaultMessagePageLimit
+	} else if limit > MaxMessagePageLimit {
+		limit = MaxMessagePageLimit
+	}
+
+	var rows pgx.Rows
+	var err error
+	if page.After > 0 {
+		getDirectMessagesAfterQuery := `
+        SELECT d.id, d.sender_id, u.username, ` + userNameColumn + `, d.recipient_id, d.body, d.created_at, d.read_at
+        FROM direct_messages d
+        INNER JOIN users u ON u.id = d.sender_id
+        WHERE ` + conversationCondition + ` AND d.id > $3
+        ORDER BY d.id ASC
+        LIMIT $4`
+		rows, err = service.db.Query(ctx, getDirectMessagesAfterQuery, userID, otherUserID, page.After, limit)
+	} else {
+		// The cursor is cast like in GetMessages, or ids past the int4 range could not be sent.
+		getDirectMessagesBeforeQuery := `
+        SELECT d.id, d.sender_id, u.username, ` + userNameColumn + `, d.recipient_id, d.body, d.created_at, d.read_at
+        FROM direct_messages d
+        INNER JOIN users u ON u.id = d.sender_id
+        WHERE ` + conversationCondition + ` AND ($3::BIGINT = 0 OR d.id < $3::BIGINT)
+        ORDER BY d.id DESC
+        LIMIT $4`
+		rows, err = service.db.Query(ctx, getDirectMessagesBeforeQuery, userID, otherUserID, page.Before, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := pgx.CollectRows(rows, scanDirectMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	if page.After <= 0 {
+		slices.Reverse(messages)
+	}
+
+	return messages, nil
+}
+
+// MarkConversationRead marks every message the other user sent to the user as read.
+func (service *DirectMessageService) MarkConversationRead(ctx context.Context, userID int64, otherUserID int64) error {
+	markReadQuery := `
+    UPDATE direct_messages
+    SET read_at = NOW()
+    WHERE recipient_id = $1 AND sender_id = $2 AND read_at IS NULL`
+
+	_, err := service.db.Exec(ctx, markReadQuery, userID, otherUserID)
+	return err
+}
+
+// ListConversations returns the user's conversations with the most recently active first.
+func (service *DirectMessageService) ListConversations(ctx context.Context, userID int64) ([]Conversation, error) {
+	listConversationsQuery := `
+    SELECT c.other_user_id, u.username, ` + userNameColumn + `, c.last_message_at, c.unread_count
+    FROM (
+        SELECT CASE WHEN d.sender_id = $1 THEN d.recipient_id ELSE d.sender_id END AS other_user_id,
+               MAX(d.created_at) AS last_message_at,
+               COUNT(*) FILTER (WHERE d.recipient_id = $1 AND d.read_at IS NULL) AS unread_count
+        FROM direct_messages d
+        WHERE d.sender_id = $1 OR d.recipient_id = $1
+        GROUP BY other_user_id
+    ) c
+    INNER JOIN users u ON u.id = c.other_user_id
+    ORDER BY c.last_message_at DESC`
+
+	rows, err := service.db.Query(ctx, listConversationsQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Conversation, error) {
+		var conversation Conversation
+		err := row.Scan(
+			&conversation.OtherUserID,
+			&conversation.OtherUsername,
+			&conversation.OtherName,
+			&conversation.LastMessageAt,
+			&conversation.UnreadCount,
+		)
+		return conversation, err
+	})
+}
+
+// GetUnreadCount returns the number of direct messages waiting to be read by the user.
+func (service *DirectMessageService) GetUnreadCount(ctx context.Context, userID int64) (int64, error) {
+	unreadCountQuery := `
+    SELECT COUNT(*)
+    FROM direct_messages
+    WHERE recipient_id = $1 AND read_at IS NULL`
+
+	var count int64
+	err := service.db.QueryRow(ctx, unreadCountQuery, userID).Scan(&count)
+	return count, err
+}
+
+func scanDirectMessage(row pgx.CollectableRow) (DirectMessage, error) {
+	var message DirectMessage
+	err := row.Scan(
+		&message.ID,
+		&message.SenderID,
+		&message.SenderUsername,
+		&message.SenderName,
+		&message.RecipientID,
+		&message.Body,
+		&message.CreatedAt,
+		&message.ReadAt,
+	)
+	return message, err
+}
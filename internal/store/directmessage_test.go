@@ -0,0 +1,35 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDirectMessageServiceGetDirectMessagesBeforeLargeCursor(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserService(db, testHashers(t), LockoutPolicy{})
+	directMessages := NewDirectMessageService(db)
+	ctx := context.Background()
+
+	alice, err := users.CreateUser(uniqueName("alice"), "password123", "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := users.CreateUser(uniqueName("bob"), "password123", "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = directMessages.CreateDirectMessage(ctx, alice.ID, bob.ID, "hi bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Past the largest int4, which is what an untyped cursor would be sent as.
+	history, err := directMessages.GetDirectMessages(ctx, bob.ID, alice.ID, MessagePage{Before: 1 << 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Errorf("got %d messages, want 1", len(history))
+	}
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// EmailVerificationStore keeps the single use tokens emailed to users to prove they own their email.
+type EmailVerificationStore interface {
+	// CreateEmailVerificationToken stores a token which can verify the email until it expires.
+	CreateEmailVerificationToken(ctx context.Context, token string, userID int64, email string, ttl time.Duration) error
+	// VerifyEmail uses up the token to mark its user's email verified, returning their id, and
+	// deletes every other token they have. It returns ErrVerificationTokenInvalid if the token does
+	// not exist, has expired, belongs to a user who is no longer active or was sent to an email the
+	// user has since changed, and ErrEmailTaken if another user has verified the email first.
+	VerifyEmail(ctx context.Context, token string) (int64, error)
+	// DeleteExpiredEmailVerificationTokens deletes up to limit expired tokens and returns how many
+	// were deleted. Used tokens are already gone, so these are the links nobody followed.
+	DeleteExpiredEmailVerificationTokens(ctx context.Context, limit int) (int64, error)
+}
+
+var ErrVerificationTokenInvalid = errors.New("email verification token is invalid or expired")
+
+// HashVerificationToken returns the hex encoded SHA-256 of the token, which is what stores persist.
+func HashVerificationToken(token string) string {
+	return HashSessionID(token)
+}
+
+// EmailVerificationService is the Postgres backed EmailVerificationStore.
+type EmailVerificationService struct {
+	db *pgxpool.Pool
+}
+
+func NewEmailVerificationService(db *pgxpool.Pool) EmailVerificationService {
+	return EmailVerificationService{db: db}
+}
+
+var _ EmailVerificationStore = (*EmailVerificationService)(nil)
+
+func (service *EmailVerificationService) CreateEmailVerificationToken(ctx context.Context, token string, userID int64, email string, ttl time.Duration) error {
+	createTokenQuery := `
+    INSERT INTO email_verification_tokens (token_hash, user_id, email, expires_at)
+    VALUES ($1, $2, $3, NOW() + make_interval(secs => $4::float8))`
+
+	_, err := service.db.Exec(ctx, createTokenQuery, HashVerificationToken(token), userID, email, ttl.Seconds())
+	return err
+}
+
+func (service *EmailVerificationService) VerifyEmail(ctx context.Context, token string) (int64, error) {
+	tx, err := service.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	useTokenQuery := `
+    DELETE FROM email_verification_tokens
+    WHERE token_hash = $1
+    RETURNING user_id, email, expires_at > NOW()`
+
+	var userID int64
+	var email string
+	var isUnexpired bool
+	err = tx.QueryRow(ctx, useTokenQuery, HashVerificationToken(token)).Scan(&userID, &email, &isUnexpired)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrVerificationTokenInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !isUnexpired {
+		err = tx.Commit(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return 0, ErrVerificationTokenInvalid
+	}
+
+	// An email which is already verified keeps the time it first was.
+	verifyEmailQuery := `
+    UPDATE users
+    SET email_verified_at = COALESCE(email_verified_at, NOW())
+    WHERE id = $1 AND is_active = true AND lower(email) = lower($2)`
+
+	tag, err := tx.Exec(ctx, verifyEmailQuery, userID, email)
+	if isUniqueViolationOf(err, verifiedEmailIndex) {
+		return 0, ErrEmailTaken
+	}
+	if err != nil {
+		return 0, err
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, ErrVerificationTokenInvalid
+	}
+
+	deleteUserTokensQuery := `
+    DELETE FROM email_verification_tokens
+    WHERE user_id = $1`
+
+	_, err = tx.Exec(ctx, deleteUserTokensQuery, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit(ctx)
+}
+
+func (service *EmailVerificationService) DeleteExpiredEmailVerificationTokens(ctx context.Context, limit int) (int64, error) {
+	deleteExpiredTokensQuery := `
+    DELETE FROM email_verification_tokens
+    WHERE token_hash IN (
+        SELECT token_hash
+        FROM email_verification_tokens
+        WHERE expires_at <= NOW()
+        LIMIT $1
+    )`
+
+	tag, err := service.db.Exec(ctx, deleteExpiredTokensQuery, limit)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
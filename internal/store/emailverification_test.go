@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEmailVerificationServiceDeleteExpiredEmailVerificationTokens(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserService(db, testHashers(t), LockoutPolicy{})
+	verifications := NewEmailVerificationService(db)
+	ctx := context.Background()
+
+	email := uniqueName("user") + "@example.com"
+	user, err := users.CreateUser(uniqueName("user"), "password123", email, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := uniqueName("expired")
+	err = verifications.CreateEmailVerificationToken(ctx, expired, user.ID, email, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := uniqueName("current")
+	err = verifications.CreateEmailVerificationToken(ctx, current, user.ID, email, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Other tests may have left expired tokens behind, so sweep until they are all gone.
+	for {
+		deleted, err := verifications.DeleteExpiredEmailVerificationTokens(ctx, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted < 100 {
+			break
+		}
+	}
+
+	for _, test := range []struct {
+		token     string
+		wantExist bool
+	}{{expired, false}, {current, true}} {
+		var exists bool
+		err = db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM email_verification_tokens WHERE token_hash = $1)", HashVerificationToken(test.token)).Scan(&exists)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != test.wantExist {
+			t.Errorf("token %q exists = %t, want %t", test.token, exists, test.wantExist)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"gochat/main/internal/models"
+)
+
+// MemorySessionStore is a SessionStore which keeps sessions in memory.
+// Sessions are lost on restart so it is only meant for tests and local development.
+type MemorySessionStore struct {
+	mu sync.Mutex
+	// sessions is keyed by the hashed session id, like the other stores.
+	sessions map[string]models.Session
+}
+
+var _ SessionStore = (*MemorySessionStore)(nil)
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]models.Session),
+	}
+}
+
+func (store *MemorySessionStore) CreateSession(ctx context.Context, sessionID string, userID int64, expiresAt time.Time, metadata models.SessionMetadata) (models.Session, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	session := models.Session{
+		SessionIDHash: HashSessionID(sessionID),
+		UserID:        userID,
+		ExpiresAt:     expiresAt,
+		CreatedAt:     now,
+		LastSeenAt:    now,
+		SessionMetadata: models.SessionMetadata{
+			UserAgent: truncateUserAgent(metadata.UserAgent),
+			IPAddress: metadata.IPAddress,
+		},
+	}
+	store.sessions[session.SessionIDHash] = session
+	return session, nil
+}
+
+func (store *MemorySessionStore) GetSession(ctx context.Context, sessionID string) (models.Session, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	session, ok := store.sessions[HashSessionID(sessionID)]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return models.Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (store *MemorySessionStore) DeleteSession(ctx context.Context, sessionID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.sessions, HashSessionID(sessionID))
+	return nil
+}
+
+func (store *MemorySessionStore) DeleteUserSessions(ctx context.Context, userID int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for sessionIDHash, session := range store.sessions {
+		if session.UserID == userID {
+			delete(store.sessions, sessionIDHash)
+		}
+	}
+	return nil
+}
+
+func (store *MemorySessionStore) DeleteUserSession(ctx context.Context, userID int64, sessionIDHash string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	session, ok := store.sessions[sessionIDHash]
+	if !ok || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	delete(store.sessions, sessionIDHash)
+	return nil
+}
+
+func (store *MemorySessionStore) DeleteUserSessionsExcept(ctx context.Context, userID int64, keepSessionID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	keepSessionIDHash := HashSessionID(keepSessionID)
+	for sessionIDHash, session := range store.sessions {
+		if session.UserID == userID && sessionIDHash != keepSessionIDHash {
+			delete(store.sessions, sessionIDHash)
+		}
+	}
+	return nil
+}
+
+func (store *MemorySessionStore) ListUserSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	var userSessions []models.Session
+	for _, session := range store.sessions {
+		if session.UserID == userID && session.ExpiresAt.After(now) {
+			userSessions = append(userSessions, session)
+		}
+	}
+
+	slices.SortFunc(userSessions, func(a, b models.Session) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+	return userSessions, nil
+}
+
+func (store *MemorySessionStore) TouchSession(ctx context.Context, sessionID string, lastSeenAt time.Time, expiresAt time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	sessionIDHash := HashSessionID(sessionID)
+	session, ok := store.sessions[sessionIDHash]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return ErrSessionNotFound
+	}
+
+	session.LastSeenAt = lastSeenAt
+	session.ExpiresAt = expiresAt
+	store.sessions[sessionIDHash] = session
+	return nil
+}
+
+func (store *MemorySessionStore) CountActiveSessions(ctx context.Context) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	var count int64
+	for _, session := range store.sessions {
+		if session.ExpiresAt.After(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (store *MemorySessionStore) DeleteExpiredSessions(ctx context.Context, limit int) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	var deleted int64
+	for sessionIDHash, session := range store.sessions {
+		if deleted >= int64(limit) {
+			break
+		}
+		if !session.ExpiresAt.After(now) {
+			delete(store.sessions, sessionIDHash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MessageStore persists the messages posted in rooms.
+type MessageStore interface {
+	CreateMessage(ctx context.Context, roomID int64, userID int64, body string) (Message, error)
+	GetMessages(ctx context.Context, roomID int64, page MessagePage) ([]Message, error)
+}
+
+// MessageService is the Postgres backed MessageStore.
+type MessageService struct {
+	db *pgxpool.Pool
+}
+
+func NewMessageService(db *pgxpool.Pool) MessageService {
+	return MessageService{
+		db: db,
+	}
+}
+
+var _ MessageStore = (*MessageService)(nil)
+
+type Message struct {
+	ID       int64
+	RoomID   int64
+	UserID   int64
+	Username string
+	// Name is the sender's display name, or their username if they have none.
+	Name      string
+	Body      string
+	CreatedAt time.Time
+}
+
+// MessagePage describes a window of history relative to a message id.
+// When Before is set the newest messages older than it are returned, when After is set the
+// oldest messages newer than it are returned, otherwise the most recent messages are returned.
+type MessagePage struct {
+	Before int64
+	After  int64
+	Limit  int
+}
+
+const (
+	DefaultMessagePageLimit = 50
+	MaxMessagePageLimit     = 100
+)
+
+// CreateMessage posts the message to the room. It returns ErrNotRoomMember if the user is not
+// a member of the room or the room has been archived, since both leave the user unable to post.
+func (service *MessageService) CreateMessage(ctx context.Context, roomID int64, userID int64, body string) (Message, error) {
+	createMessageQuery := `
+    WITH inserted AS (
+        INSERT INTO messages (room_id, user_id, body)
+        SELECT $1, $2, $3
+        WHERE EXISTS (
+            SELECT 1
+            FROM room_members m
+            INNER JOIN rooms r ON r.id = m.room_id
+            WHERE m.room_id = $1 AND m.user_id = $2 AND r.archived_at IS NULL
+        )
+        RETURNING id, room_id, user_id, body, created_at
+    )
+    SELECT i.id, i.room_id, i.user_id, u.username, ` + userNameColumn + `, i.body, i.created_at
+    FROM inserted i
+    INNER JOIN users u ON u.id = i.user_id`
+
+	var message Message
+	err := service.db.QueryRow(ctx, createMessageQuery, roomID, userID, body).Scan(
+		&message.ID,
+		&message.RoomID,
+		&message.UserID,
+		&message.Username,
+		&message.Name,
+		&message.Body,
+		&message.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Message{}, ErrNotRoomMember
+		}
+		return Message{}, err
+	}
+
+	return message, nil
+}
+
+// GetMessages returns a page of the room's history ordered from oldest to newest.
+func (service *MessageService) GetMessages(ctx context.Context, roomID int64, page MessagePage) ([]Message, error) {
+	limit := page.Limit
+	if limit <= 0 {
+		limit = DefaultMessagePageLimit
+	} else if limit > MaxMessagePageLimit {
+		limit = MaxMessagePageLimit
+	}
+
+	var rows pgx.Rows
+	var err error
+	if page.After > 0 {
+		getMessagesAfterQuery := `
+        SELECT m.id, m.room_id, m.user_id, u.username, ` + userNameColumn + `, m.body, m.created_at
+        FROM messages m
+        INNER JOIN users u ON u.id = m.user_id
+        WHERE m.room_id = $1 AND m.id > $2
+        ORDER BY m.id ASC
+        LIMIT $3`
+		rows, err = service.db.Query(ctx, getMessagesAfterQuery, roomID, page.After, limit)
+	} else {
+		// Walk backwards from the cursor (or the newest message) then flip the order below. The
+		// cursor is cast since comparing it with 0 would make it an int4, too small for later ids.
+		getMessagesBeforeQuery := `
+        SELECT m.id, m.room_id, m.user_id, u.username, ` + userNameColumn + `, m.body, m.created_at
+        FROM messages m
+        INNER JOIN users u ON u.id = m.user_id
+        WHERE m.room_id = $1 AND ($2::bigint = 0 OR m.id < $2::bigint)
+        ORDER BY m.id DESC
+        LIMIT $3`
+		rows, err = service.db.Query(ctx, getMessagesBeforeQuery, roomID, page.Before, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := pgx.CollectRows(rows, scanMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	if page.After <= 0 {
+		slices.Reverse(messages)
+	}
+
+	return messages, nil
+}
+
+func scanMessage(row pgx.CollectableRow) (Message, error) {
+	var message Message
+	err := row.Scan(
+		&message.ID,
+		&message.RoomID,
+		&message.UserID,
+		&message.Username,
+		&message.Name,
+		&message.Body,
+		&message.CreatedAt,
+	)
+	return message, err
+}
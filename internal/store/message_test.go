@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMessagesShowDisplayNames(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserService(db, testHashers(t), LockoutPolicy{})
+	rooms := NewRoomService(db)
+	messages := NewMessageService(db)
+	directMessages := NewDirectMessageService(db)
+	ctx := context.Background()
+
+	alice, err := users.CreateUser(uniqueName("alice"), "password123", "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, err = users.UpdateDisplayName(ctx, alice.ID, "Alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Bob has no display name, so he goes by his username.
+	bob, err := users.CreateUser(uniqueName("bob"), "password123", "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	room, err := rooms.CreateRoom(ctx, uniqueName("room"), alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rooms.JoinRoom(ctx, room.ID, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := messages.CreateMessage(ctx, room.ID, alice.ID, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Name != "Alice" {
+		t.Errorf("posted message Name = %q, want %q", message.Name, "Alice")
+	}
+	history, err := messages.GetMessages(ctx, room.ID, MessagePage{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Name != "Alice" {
+		t.Errorf("history = %+v, want alice's message under %q", history, "Alice")
+	}
+
+	members, err := rooms.GetRoomMembers(ctx, room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[int64]string)
+	for _, member := range members {
+		names[member.UserID] = member.Name
+	}
+	if names[alice.ID] != "Alice" || names[bob.ID] != bob.Username {
+		t.Errorf("member names = %v, want %q and %q", names, "Alice", bob.Username)
+	}
+
+	directMessage, err := directMessages.CreateDirectMessage(ctx, alice.ID, bob.ID, "hi bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if directMessage.SenderName != "Alice" {
+		t.Errorf("direct message SenderName = %q, want %q", directMessage.SenderName, "Alice")
+	}
+	conversations, err := directMessages.ListConversations(ctx, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversations) != 1 || conversations[0].OtherName != "Alice" {
+		t.Errorf("bob's conversations = %+v, want one with %q", conversations, "Alice")
+	}
+}
+
+func TestMessageServiceGetMessagesBeforeLargeCursor(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserService(db, testHashers(t), LockoutPolicy{})
+	rooms := NewRoomService(db)
+	messages := NewMessageService(db)
+	ctx := context.Background()
+
+	user, err := users.CreateUser(uniqueName("user"), "password123", "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, err := rooms.CreateRoom(ctx, uniqueName("room"), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = messages.CreateMessage(ctx, room.ID, user.ID, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Past the largest int4, which is what an untyped cursor would be sent as.
+	history, err := messages.GetMessages(ctx, room.ID, MessagePage{Before: 1 << 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Errorf("got %d messages, want 1", len(history))
+	}
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gochat/main/internal/utils/passwords"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PasswordResetStore keeps the single use tokens emailed to users who have forgotten their password.
+type PasswordResetStore interface {
+	// CreatePasswordResetToken stores a token which can reset the user's password until it expires.
+	CreatePasswordResetToken(ctx context.Context, token string, userID int64, ttl time.Duration) error
+	// ResetPassword uses up the token to set the password of its user, returning their id, and
+	// deletes every other token they have. It returns ErrResetTokenInvalid if the token does not
+	// exist, has expired or belongs to a user who is no longer active.
+	ResetPassword(ctx context.Context, token string, newPassword string) (int64, error)
+	// DeleteExpiredPasswordResetTokens deletes up to limit expired tokens and returns how many were
+	// deleted. Used tokens are already gone, so these are the links nobody followed.
+	DeleteExpiredPasswordResetTokens(ctx context.Context, limit int) (int64, error)
+}
+
+var ErrResetTokenInvalid = errors.New("password reset token is invalid or expired")
+
+// HashResetToken returns the hex encoded SHA-256 of the token, which is what stores persist.
+// As with session ids a plain hash is enough, since tokens are random and can not be guessed.
+func HashResetToken(token string) string {
+	return HashSessionID(token)
+}
+
+// PasswordResetService is the Postgres backed PasswordResetStore.
+type PasswordResetService struct {
+	db *pgxpool.Pool
+	// hashers hash the new passwords, like UserService.
+	hashers passwords.Hashers
+}
+
+func NewPasswordResetService(db *pgxpool.Pool, hashers passwords.Hashers) PasswordResetService {
+	return PasswordResetService{
+		db:      db,
+		hashers: hashers,
+	}
+}
+
+var _ PasswordResetStore = (*PasswordResetService)(nil)
+
+func (service *PasswordResetService) CreatePasswordResetToken(ctx context.Context, token string, userID int64, ttl time.Duration) error {
+	// The expiry is worked out against the database clock, which is also what checks it.
+	createTokenQuery := `
+    INSERT INTO password_reset_tokens (token_hash, user_id, expires_at)
+    VALUES ($1, $2, NOW() + make_interval(secs => $3::float8))`
+
+	_, err := service.db.Exec(ctx, createTokenQuery, HashResetToken(token), userID, ttl.Seconds())
+	return err
+}
+
+func (service *PasswordResetService) ResetPassword(ctx context.Context, token string, newPassword string) (int64, error) {
+	// Hashed up front so the transaction is not held open while it runs.
+	passHash, err := service.hashers.Hash(newPassword)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := service.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Deleting the token as it is read means two requests racing with it can not both use it.
+	useTokenQuery := `
+    DELETE FROM password_reset_tokens
+    WHERE token_hash = $1
+    RETURNING user_id, expires_at > NOW()`
+
+	var userID int64
+	var isUnexpired bool
+	err = tx.QueryRow(ctx, useTokenQuery, HashResetToken(token)).Scan(&userID, &isUnexpired)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrResetTokenInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !isUnexpired {
+		// Committed anyway, since the expired token may as well be gone.
+		err = tx.Commit(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return 0, ErrResetTokenInvalid
+	}
+
+	// Any lockout is lifted too, so an owner locked out by someone guessing can get back in.
+	resetPasswordQuery := `
+    UPDATE users
+    SET password_hash = $2, failed_login_count = 0, locked_until = NULL
+    WHERE id = $1 AND is_active = true`
+
+	tag, err := tx.Exec(ctx, resetPasswordQuery, userID, passHash)
+	if err != nil {
+		return 0, err
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, ErrResetTokenInvalid
+	}
+
+	deleteUserTokensQuery := `
+    DELETE FROM password_reset_tokens
+    WHERE user_id = $1`
+
+	_, err = tx.Exec(ctx, deleteUserTokensQuery, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit(ctx)
+}
+
+func (service *PasswordResetService) DeleteExpiredPasswordResetTokens(ctx context.Context, limit int) (int64, error) {
+	deleteExpiredTokensQuery := `
+    DELETE FROM password_reset_tokens
+    WHERE token_hash IN (
+        SELECT token_hash
+        FROM password_reset_tokens
+        WHERE expires_at <= NOW()
+        LIMIT $1
+    )`
+
+	tag, err := service.db.Exec(ctx, deleteExpiredTokensQuery, limit)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPasswordResetServiceDeleteExpiredPasswordResetTokens(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserService(db, testHashers(t), LockoutPolicy{})
+	resets := NewPasswordResetService(db, testHashers(t))
+	ctx := context.Background()
+
+	user, err := users.CreateUser(uniqueName("user"), "password123", "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := uniqueName("expired")
+	err = resets.CreatePasswordResetToken(ctx, expired, user.ID, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := uniqueName("current")
+	err = resets.CreatePasswordResetToken(ctx, current, user.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Other tests may have left expired tokens behind, so sweep until they are all gone.
+	for {
+		deleted, err := resets.DeleteExpiredPasswordResetTokens(ctx, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted < 100 {
+			break
+		}
+	}
+
+	for _, test := range []struct {
+		token     string
+		wantExist bool
+	}{{expired, false}, {current, true}} {
+		var exists bool
+		err = db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM password_reset_tokens WHERE token_hash = $1)", HashResetToken(test.token)).Scan(&exists)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != test.wantExist {
+			t.Errorf("token %q exists = %t, want %t", test.token, exists, test.wantExist)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gochat/main/internal/migrations"
+	"gochat/main/internal/utils/passwords"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testDatabaseURLEnv names the database the Postgres backed stores are tested against, and the
+// tests using it are skipped when it is unset. It is migrated and filled with test users, so it
+// must never hold real data.
+const testDatabaseURLEnv = "GOCHAT_TEST_DATABASE_URL"
+
+// newTestDB connects to the test database and migrates it.
+func newTestDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv(testDatabaseURLEnv)
+	if url == "" {
+		t.Skipf("%s is not set", testDatabaseURLEnv)
+	}
+
+	db, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = migrator.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// queryCounter is a pgx tracer which counts the queries sent to the database.
+type queryCounter struct {
+	queries atomic.Int64
+}
+
+func (counter *queryCounter) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	counter.queries.Add(1)
+	return ctx
+}
+
+func (counter *queryCounter) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+}
+
+// newCountingTestDB connects to the migrated test database with a pool which counts its queries.
+func newCountingTestDB(t *testing.T) (*pgxpool.Pool, *queryCounter) {
+	t.Helper()
+
+	newTestDB(t)
+	config, err := pgxpool.ParseConfig(os.Getenv(testDatabaseURLEnv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := &queryCounter{}
+	config.ConnConfig.Tracer = counter
+	db, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return db, counter
+}
+
+var uniqueNameCount atomic.Int64
+
+// uniqueName returns a name no other test, in this run or an earlier one, has used, since the test
+// database is not emptied between runs.
+func uniqueName(prefix string) string {
+	return fmt.Sprintf("%s-%d-%d", prefix, time.Now().UnixNano(), uniqueNameCount.Add(1))
+}
+
+// testHashers are cheap to run, since the tests are not about the hashing cost.
+func testHashers(t *testing.T) passwords.Hashers {
+	t.Helper()
+
+	hashers, err := passwords.NewHashers(passwords.NewArgon2IdHasher(passwords.Argon2IdParams{Time: 1, Memory: 8 * 1024, Threads: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hashers
+}
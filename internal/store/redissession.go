@@ -0,0 +1,394 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"gochat/main/internal/models"
+	"gochat/main/internal/utils/resp"
+)
+
+// RedisSessionStore is a SessionStore for servers speaking the Redis protocol.
+// Each session is a hash which the server expires at the session's expiry, and each user has a set
+// of their session id hashes, expiring with the last of them, so they can all be deleted together.
+// Keys use the hashed session id.
+type RedisSessionStore struct {
+	client    *resp.Client
+	keyPrefix string
+}
+
+var _ SessionStore = (*RedisSessionStore)(nil)
+
+// touchSessionScript updates a session's times and expiry, but only if it still exists, and returns
+// the session's user id. Scripts run atomically, so a session deleted in between can not be
+// recreated by the HSET, without an expiry.
+const touchSessionScript = `
+if redis.call("EXISTS", KEYS[1]) == 0 then
+  return false
+end
+redis.call("HSET", KEYS[1], "expires_at", ARGV[2], "last_seen_at", ARGV[3])
+redis.call("PEXPIREAT", KEYS[1], ARGV[1])
+return redis.call("HGET", KEYS[1], "user_id")`
+
+// extendExpiryScript moves an existing key's expiry out to ARGV[1], but never earlier, given the
+// time is now ARGV[2]. A user's set of sessions expires with the last of them this way, rather
+// than living forever once the sessions themselves have expired.
+const extendExpiryScript = `
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl == -2 then
+  return 0
+end
+if ttl == -1 or tonumber(ARGV[2]) + ttl < tonumber(ARGV[1]) then
+  redis.call("PEXPIREAT", KEYS[1], ARGV[1])
+end
+return 1`
+
+// deleteUserSessionsScript deletes every session in the user's set except the one hashed in ARGV[2],
+// if any, where ARGV[1] is the prefix of session keys. Reading the set and deleting in one script
+// means a session created meanwhile can not be missed. The session keys come from the set, so
+// they can not be passed in KEYS.
+const deleteUserSessionsScript = `
+local deleted = 0
+for _, sessionIDHash in ipairs(redis.call("SMEMBERS", KEYS[1])) do
+  if sessionIDHash ~= ARGV[2] then
+    redis.call("DEL", ARGV[1] .. sessionIDHash)
+    redis.call("SREM", KEYS[1], sessionIDHash)
+    deleted = deleted + 1
+  end
+end
+return deleted`
+
+func NewRedisSessionStore(client *resp.Client, keyPrefix string) *RedisSessionStore {
+	return &RedisSessionStore{
+		client:    client,
+		keyPrefix: keyPrefix,
+	}
+}
+
+func (store *RedisSessionStore) sessionKey(sessionIDHash string) string {
+	return store.keyPrefix + "session:" + sessionIDHash
+}
+
+func (store *RedisSessionStore) userSessionsKey(userID int64) string {
+	return store.keyPrefix + "user_sessions:" + strconv.FormatInt(userID, 10)
+}
+
+func (store *RedisSessionStore) CreateSession(ctx context.Context, sessionID string, userID int64, expiresAt time.Time, metadata models.SessionMetadata) (models.Session, error) {
+	now := time.Now()
+	session := models.Session{
+		SessionIDHash: HashSessionID(sessionID),
+		UserID:        userID,
+		ExpiresAt:     expiresAt,
+		CreatedAt:     now,
+		LastSeenAt:    now,
+		SessionMetadata: models.SessionMetadata{
+			UserAgent: truncateUserAgent(metadata.UserAgent),
+			IPAddress: metadata.IPAddress,
+		},
+	}
+
+	sessionKey := store.sessionKey(session.SessionIDHash)
+	err := store.exec(ctx,
+		[]string{"HSET", sessionKey,
+			"user_id", strconv.FormatInt(userID, 10),
+			"expires_at", formatTime(session.ExpiresAt),
+			"created_at", formatTime(session.CreatedAt),
+			"last_seen_at", formatTime(session.LastSeenAt),
+			"user_agent", session.UserAgent,
+			"ip_address", session.IPAddress,
+		},
+		[]string{"PEXPIREAT", sessionKey, strconv.FormatInt(expiresAt.UnixMilli(), 10)},
+		[]string{"SADD", store.userSessionsKey(userID), session.SessionIDHash},
+		store.extendExpiry(store.userSessionsKey(userID), expiresAt, now),
+	)
+	if err != nil {
+		return models.Session{}, err
+	}
+	return session, nil
+}
+
+func (store *RedisSessionStore) GetSession(ctx context.Context, sessionID string) (models.Session, error) {
+	sessionIDHash := HashSessionID(sessionID)
+	fields, err := resp.StringMap(store.client.Do(ctx, "HGETALL", store.sessionKey(sessionIDHash)))
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	session, err := parseRedisSession(sessionIDHash, fields)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	// The server expires keys lazily, so double check in case this one is overdue.
+	if !session.ExpiresAt.After(time.Now()) {
+		return models.Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (store *RedisSessionStore) DeleteSession(ctx context.Context, sessionID string) error {
+	sessionIDHash := HashSessionID(sessionID)
+	sessionKey := store.sessionKey(sessionIDHash)
+
+	userIDValue, err := resp.String(store.client.Do(ctx, "HGET", sessionKey, "user_id"))
+	if err != nil {
+		if errors.Is(err, resp.ErrNil) {
+			return nil
+		}
+		return err
+	}
+
+	userID, err := strconv.ParseInt(userIDValue, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid user id on session: %w", err)
+	}
+
+	return store.exec(ctx,
+		[]string{"DEL", sessionKey},
+		[]string{"SREM", store.userSessionsKey(userID), sessionIDHash},
+	)
+}
+
+func (store *RedisSessionStore) DeleteUserSessions(ctx context.Context, userID int64) error {
+	return store.deleteUserSessions(ctx, userID, "")
+}
+
+func (store *RedisSessionStore) DeleteUserSession(ctx context.Context, userID int64, sessionIDHash string) error {
+	sessionKey := store.sessionKey(sessionIDHash)
+
+	ownerID, err := resp.String(store.client.Do(ctx, "HGET", sessionKey, "user_id"))
+	if err != nil {
+		if errors.Is(err, resp.ErrNil) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+	if ownerID != strconv.FormatInt(userID, 10) {
+		return ErrSessionNotFound
+	}
+
+	return store.exec(ctx,
+		[]string{"DEL", sessionKey},
+		[]string{"SREM", store.userSessionsKey(userID), sessionIDHash},
+	)
+}
+
+func (store *RedisSessionStore) DeleteUserSessionsExcept(ctx context.Context, userID int64, keepSessionID string) error {
+	return store.deleteUserSessions(ctx, userID, HashSessionID(keepSessionID))
+}
+
+// deleteUserSessions deletes the user's sessions, except the one with the hash if it is not empty.
+func (store *RedisSessionStore) deleteUserSessions(ctx context.Context, userID int64, keepSessionIDHash string) error {
+	_, err := resp.Int(store.client.Do(ctx, "EVAL", deleteUserSessionsScript, "1", store.userSessionsKey(userID),
+		store.sessionKey(""),
+		keepSessionIDHash,
+	))
+	return err
+}
+
+func (store *RedisSessionStore) ListUserSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	userSessionsKey := store.userSessionsKey(userID)
+
+	sessionIDHashes, err := resp.Strings(store.client.Do(ctx, "SMEMBERS", userSessionsKey))
+	if err != nil {
+		return nil, err
+	}
+	if len(sessionIDHashes) == 0 {
+		return nil, nil
+	}
+
+	commands := make([][]string, len(sessionIDHashes))
+	for i, sessionIDHash := range sessionIDHashes {
+		commands[i] = []string{"HGETALL", store.sessionKey(sessionIDHash)}
+	}
+
+	replies, err := store.client.Pipeline(ctx, commands...)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var userSessions []models.Session
+	var expiredSessionIDHashes []string
+	for i, reply := range replies {
+		fields, err := resp.StringMap(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// Anything unreadable is treated like an expired session, which is how it got that way.
+		session, err := parseRedisSession(sessionIDHashes[i], fields)
+		if err != nil || !session.ExpiresAt.After(now) {
+			expiredSessionIDHashes = append(expiredSessionIDHashes, sessionIDHashes[i])
+			continue
+		}
+		userSessions = append(userSessions, session)
+	}
+
+	// The server expired these sessions but can not remove them from the user's set, so tidy up here.
+	if len(expiredSessionIDHashes) > 0 {
+		srem := append([]string{"SREM", userSessionsKey}, expiredSessionIDHashes...)
+		_, err = resp.Int(store.client.Do(ctx, srem...))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	slices.SortFunc(userSessions, func(a, b models.Session) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+	return userSessions, nil
+}
+
+func (store *RedisSessionStore) TouchSession(ctx context.Context, sessionID string, lastSeenAt time.Time, expiresAt time.Time) error {
+	sessionKey := store.sessionKey(HashSessionID(sessionID))
+
+	userIDValue, err := resp.String(store.client.Do(ctx, "EVAL", touchSessionScript, "1", sessionKey,
+		strconv.FormatInt(expiresAt.UnixMilli(), 10),
+		formatTime(expiresAt),
+		formatTime(lastSeenAt),
+	))
+	if err != nil {
+		if errors.Is(err, resp.ErrNil) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+
+	userID, err := strconv.ParseInt(userIDValue, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid user id on session: %w", err)
+	}
+
+	_, err = resp.Int(store.client.Do(ctx, store.extendExpiry(store.userSessionsKey(userID), expiresAt, time.Now())...))
+	return err
+}
+
+// extendExpiry returns the command to move the key's expiry out to expiresAt, if it is earlier.
+func (store *RedisSessionStore) extendExpiry(key string, expiresAt time.Time, now time.Time) []string {
+	return []string{"EVAL", extendExpiryScript, "1", key,
+		strconv.FormatInt(expiresAt.UnixMilli(), 10),
+		strconv.FormatInt(now.UnixMilli(), 10),
+	}
+}
+
+// DeleteExpiredSessions is a no-op since the server expires session keys itself.
+func (store *RedisSessionStore) DeleteExpiredSessions(ctx context.Context, limit int) (int64, error) {
+	return 0, nil
+}
+
+// CountActiveSessions counts the session keys with SCAN, which walks the keyspace in small steps
+// rather than blocking the server like KEYS would.
+func (store *RedisSessionStore) CountActiveSessions(ctx context.Context) (int64, error) {
+	pattern := store.sessionKey("*")
+	cursor := "0"
+	var count int64
+	for {
+		reply, err := store.client.Do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", "1000")
+		if err != nil {
+			return 0, err
+		}
+		if replyErr, ok := reply.(resp.Error); ok {
+			return 0, replyErr
+		}
+		page, ok := reply.([]any)
+		if !ok || len(page) != 2 {
+			return 0, fmt.Errorf("unexpected SCAN reply %v", reply)
+		}
+
+		cursor, err = resp.String(page[0], nil)
+		if err != nil {
+			return 0, err
+		}
+		keys, err := resp.Strings(page[1], nil)
+		if err != nil {
+			return 0, err
+		}
+		count += int64(len(keys))
+
+		if cursor == "0" {
+			return count, nil
+		}
+	}
+}
+
+// exec runs the commands atomically in a MULTI/EXEC transaction.
+func (store *RedisSessionStore) exec(ctx context.Context, commands ...[]string) error {
+	pipeline := make([][]string, 0, len(commands)+2)
+	pipeline = append(pipeline, []string{"MULTI"})
+	pipeline = append(pipeline, commands...)
+	pipeline = append(pipeline, []string{"EXEC"})
+
+	replies, err := store.client.Pipeline(ctx, pipeline...)
+	if err != nil {
+		return err
+	}
+
+	// A command rejected while queueing aborts the whole transaction.
+	for _, reply := range replies {
+		if replyErr, ok := reply.(resp.Error); ok {
+			return replyErr
+		}
+	}
+
+	results, ok := replies[len(replies)-1].([]any)
+	if !ok {
+		return errors.New("session transaction was aborted")
+	}
+	for _, result := range results {
+		if resultErr, ok := result.(resp.Error); ok {
+			return resultErr
+		}
+	}
+	return nil
+}
+
+func parseRedisSession(sessionIDHash string, fields map[string]string) (models.Session, error) {
+	if len(fields) == 0 {
+		return models.Session{}, ErrSessionNotFound
+	}
+
+	userID, err := strconv.ParseInt(fields["user_id"], 10, 64)
+	if err != nil {
+		return models.Session{}, fmt.Errorf("invalid user id on session: %w", err)
+	}
+
+	expiresAt, err := parseTime(fields["expires_at"])
+	if err != nil {
+		return models.Session{}, fmt.Errorf("invalid expiry on session: %w", err)
+	}
+
+	createdAt, err := parseTime(fields["created_at"])
+	if err != nil {
+		return models.Session{}, fmt.Errorf("invalid creation time on session: %w", err)
+	}
+
+	lastSeenAt, err := parseTime(fields["last_seen_at"])
+	if err != nil {
+		return models.Session{}, fmt.Errorf("invalid last seen time on session: %w", err)
+	}
+
+	return models.Session{
+		SessionIDHash: sessionIDHash,
+		UserID:        userID,
+		ExpiresAt:     expiresAt,
+		CreatedAt:     createdAt,
+		LastSeenAt:    lastSeenAt,
+		SessionMetadata: models.SessionMetadata{
+			UserAgent: fields["user_agent"],
+			IPAddress: fields["ip_address"],
+		},
+	}, nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, value)
+}
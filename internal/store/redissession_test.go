@@ -0,0 +1,255 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"gochat/main/internal/models"
+	"gochat/main/internal/utils/resp"
+	"gochat/main/internal/utils/resp/resptest"
+)
+
+// newTestRedisSessionStore returns a store backed by a resptest server which runs the store's
+// scripts the way Redis would.
+func newTestRedisSessionStore(t *testing.T) (*RedisSessionStore, *resptest.Server) {
+	server := resptest.NewServer(t)
+	server.HandleScript(touchSessionScript, func(call func(args ...string) any, keys []string, args []string) any {
+		if call("EXISTS", keys[0]) == int64(0) {
+			return nil
+		}
+		call("HSET", keys[0], "expires_at", args[1], "last_seen_at", args[2])
+		call("PEXPIREAT", keys[0], args[0])
+		return call("HGET", keys[0], "user_id")
+	})
+	server.HandleScript(extendExpiryScript, func(call func(args ...string) any, keys []string, args []string) any {
+		ttl := call("PTTL", keys[0]).(int64)
+		if ttl == -2 {
+			return int64(0)
+		}
+		expiresAt, _ := strconv.ParseInt(args[0], 10, 64)
+		now, _ := strconv.ParseInt(args[1], 10, 64)
+		if ttl == -1 || now+ttl < expiresAt {
+			call("PEXPIREAT", keys[0], args[0])
+		}
+		return int64(1)
+	})
+	server.HandleScript(deleteUserSessionsScript, func(call func(args ...string) any, keys []string, args []string) any {
+		var deleted int64
+		for _, member := range call("SMEMBERS", keys[0]).([]any) {
+			sessionIDHash := member.(string)
+			if sessionIDHash != args[1] {
+				call("DEL", args[0]+sessionIDHash)
+				call("SREM", keys[0], sessionIDHash)
+				deleted++
+			}
+		}
+		return deleted
+	})
+
+	client := resp.NewClient(server.Addr(), resp.Options{})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisSessionStore(client, "gochat:"), server
+}
+
+func TestRedisSessionStoreCreateAndGetSession(t *testing.T) {
+	sessions, server := newTestRedisSessionStore(t)
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+
+	created, err := sessions.CreateSession(ctx, "session-id", 7, expiresAt, models.SessionMetadata{UserAgent: "Firefox", IPAddress: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := sessions.GetSession(ctx, "session-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.UserID != 7 || !session.ExpiresAt.Equal(expiresAt) || session.UserAgent != "Firefox" || session.IPAddress != "192.0.2.1" {
+		t.Errorf("GetSession = %+v, want %+v", session, created)
+	}
+	if ttl, ok := server.TTL(sessions.sessionKey(HashSessionID("session-id"))); !ok || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("session key TTL = %s, %v, want up to an hour", ttl, ok)
+	}
+
+	_, err = sessions.GetSession(ctx, "other-session-id")
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetSession of an unknown id err = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestRedisSessionStoreTouchSession(t *testing.T) {
+	sessions, server := newTestRedisSessionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	sessionKey := sessions.sessionKey(HashSessionID("session-id"))
+
+	_, err := sessions.CreateSession(ctx, "session-id", 7, now.Add(time.Minute), models.SessionMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := now.Add(time.Hour).Truncate(time.Millisecond)
+	err = sessions.TouchSession(ctx, "session-id", now, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := sessions.GetSession(ctx, "session-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !session.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("ExpiresAt = %s, want %s", session.ExpiresAt, expiresAt)
+	}
+	if ttl, ok := server.TTL(sessionKey); !ok || ttl <= time.Minute {
+		t.Errorf("session key TTL = %s, %v, want it moved to an hour", ttl, ok)
+	}
+
+	// Touching a session deleted in the meantime must not bring it back.
+	err = sessions.DeleteSession(ctx, "session-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sessions.TouchSession(ctx, "session-id", now, expiresAt)
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("TouchSession after delete err = %v, want ErrSessionNotFound", err)
+	}
+	if server.Exists(sessionKey) {
+		t.Error("TouchSession recreated a deleted session")
+	}
+}
+
+func TestRedisSessionStoreExpiredSessions(t *testing.T) {
+	sessions, server := newTestRedisSessionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	_, err := sessions.CreateSession(ctx, "short-session-id", 7, now.Add(time.Minute), models.SessionMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sessions.CreateSession(ctx, "long-session-id", 7, now.Add(time.Hour), models.SessionMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.SetClock(func() time.Time { return now.Add(2 * time.Minute) })
+
+	_, err = sessions.GetSession(ctx, "short-session-id")
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetSession of an expired session err = %v, want ErrSessionNotFound", err)
+	}
+	err = sessions.TouchSession(ctx, "short-session-id", now, now.Add(time.Hour))
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("TouchSession of an expired session err = %v, want ErrSessionNotFound", err)
+	}
+
+	userSessions, err := sessions.ListUserSessions(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(userSessions) != 1 || userSessions[0].SessionIDHash != HashSessionID("long-session-id") {
+		t.Errorf("ListUserSessions = %+v, want only the unexpired session", userSessions)
+	}
+
+	// The expired session is tidied out of the user's set.
+	sessionIDHashes, err := resp.Strings(sessions.client.Do(ctx, "SMEMBERS", sessions.userSessionsKey(7)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessionIDHashes) != 1 {
+		t.Errorf("user's set holds %d sessions, want 1", len(sessionIDHashes))
+	}
+
+	count, err := sessions.CountActiveSessions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("CountActiveSessions = %d, want 1", count)
+	}
+}
+
+func TestRedisSessionStoreUserSessionsExpire(t *testing.T) {
+	sessions, server := newTestRedisSessionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	userSessionsKey := sessions.userSessionsKey(7)
+
+	_, err := sessions.CreateSession(ctx, "long-session-id", 7, now.Add(time.Hour), models.SessionMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sessions.CreateSession(ctx, "short-session-id", 7, now.Add(time.Minute), models.SessionMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The set lives as long as the longest session, not the last one created.
+	if ttl, ok := server.TTL(userSessionsKey); !ok || ttl <= time.Minute || ttl > time.Hour {
+		t.Errorf("user's set TTL = %s, %v, want up to an hour", ttl, ok)
+	}
+
+	err = sessions.TouchSession(ctx, "short-session-id", now, now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl, ok := server.TTL(userSessionsKey); !ok || ttl <= time.Hour {
+		t.Errorf("user's set TTL = %s, %v, want it moved to two hours", ttl, ok)
+	}
+
+	server.SetClock(func() time.Time { return now.Add(3 * time.Hour) })
+	if server.Exists(userSessionsKey) {
+		t.Error("user's set outlived their sessions")
+	}
+}
+
+func TestRedisSessionStoreDeleteUserSessions(t *testing.T) {
+	sessions, server := newTestRedisSessionStore(t)
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour)
+
+	for _, sessionID := range []string{"kept-session-id", "other-session-id", "another-session-id"} {
+		_, err := sessions.CreateSession(ctx, sessionID, 7, expiresAt, models.SessionMetadata{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := sessions.CreateSession(ctx, "someone-elses-session-id", 8, expiresAt, models.SessionMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sessions.DeleteUserSessionsExcept(ctx, 7, "kept-session-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userSessions, err := sessions.ListUserSessions(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(userSessions) != 1 || userSessions[0].SessionIDHash != HashSessionID("kept-session-id") {
+		t.Errorf("ListUserSessions = %+v, want only the kept session", userSessions)
+	}
+	if server.Exists(sessions.sessionKey(HashSessionID("other-session-id"))) {
+		t.Error("DeleteUserSessionsExcept left another session behind")
+	}
+
+	err = sessions.DeleteUserSessions(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sessions.GetSession(ctx, "kept-session-id")
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetSession after DeleteUserSessions err = %v, want ErrSessionNotFound", err)
+	}
+	if server.Exists(sessions.userSessionsKey(7)) {
+		t.Error("DeleteUserSessions left the user's set behind")
+	}
+	_, err = sessions.GetSession(ctx, "someone-elses-session-id")
+	if err != nil {
+		t.Errorf("GetSession of another user's session: %v", err)
+	}
+}
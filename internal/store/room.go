@@ -0,0 +1,243 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RoomStore persists rooms and who belongs to them.
+type RoomStore interface {
+	// CreateRoom returns ErrRoomNameTaken if a room already has the name.
+	CreateRoom(ctx context.Context, name string, creatorID int64) (Room, error)
+	ListRooms(ctx context.Context, userID int64) ([]Room, error)
+	// GetRoom returns ErrRoomNotFound if there is no room with the id.
+	GetRoom(ctx context.Context, roomID int64, userID int64) (Room, error)
+	GetRoomMembers(ctx context.Context, roomID int64) ([]RoomMember, error)
+	JoinRoom(ctx context.Context, roomID int64, userID int64) error
+	LeaveRoom(ctx context.Context, roomID int64, userID int64) error
+	ArchiveRoom(ctx context.Context, roomID int64, userID int64) error
+}
+
+// RoomService is the Postgres backed RoomStore.
+type RoomService struct {
+	db *pgxpool.Pool
+}
+
+func NewRoomService(db *pgxpool.Pool) RoomService {
+	return RoomService{
+		db: db,
+	}
+}
+
+var _ RoomStore = (*RoomService)(nil)
+
+type Room struct {
+	ID          int64
+	Name        string
+	CreatedBy   *int64
+	CreatedAt   time.Time
+	ArchivedAt  *time.Time
+	MemberCount int64
+	// IsMember is relative to the user the room was loaded for.
+	IsMember bool
+}
+
+func (room Room) IsArchived() bool {
+	return room.ArchivedAt != nil
+}
+
+// IsOwnedBy reports whether the user created the room.
+func (room Room) IsOwnedBy(userID int64) bool {
+	return room.CreatedBy != nil && *room.CreatedBy == userID
+}
+
+type RoomMember struct {
+	UserID   int64
+	Username string
+	// Name is the member's display name, or their username if they have none.
+	Name     string
+	JoinedAt time.Time
+}
+
+// GeneralRoomName is the room every user joins when they sign up.
+const GeneralRoomName = "general"
+
+var (
+	ErrRoomNotFound  = errors.New("room not found")
+	ErrRoomArchived  = errors.New("room is archived")
+	ErrNotRoomMember = errors.New("user is not a member of the room")
+	ErrNotRoomOwner  = errors.New("user does not own the room")
+	ErrRoomNameTaken = errors.New("room name is taken")
+)
+
+// CreateRoom creates the room and makes the creator its first member.
+func (service *RoomService) CreateRoom(ctx context.Context, name string, creatorID int64) (Room, error) {
+	tx, err := service.db.Begin(ctx)
+	if err != nil {
+		return Room{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	createRoomQuery := `
+    INSERT INTO rooms (name, created_by)
+    VALUES ($1, $2)
+    RETURNING id, name, created_by, created_at, archived_at`
+
+	var room Room
+	err = tx.QueryRow(ctx, createRoomQuery, name, creatorID).Scan(
+		&room.ID,
+		&room.Name,
+		&room.CreatedBy,
+		&room.CreatedAt,
+		&room.ArchivedAt,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return Room{}, ErrRoomNameTaken
+		}
+		return Room{}, err
+	}
+
+	addMemberQuery := `INSERT INTO room_members (room_id, user_id) VALUES ($1, $2)`
+	_, err = tx.Exec(ctx, addMemberQuery, room.ID, creatorID)
+	if err != nil {
+		return Room{}, err
+	}
+
+	room.MemberCount = 1
+	room.IsMember = true
+	return room, tx.Commit(ctx)
+}
+
+// ListRooms returns every room which has not been archived, ordered by name.
+func (service *RoomService) ListRooms(ctx context.Context, userID int64) ([]Room, error) {
+	listRoomsQuery := `
+    SELECT r.id, r.name, r.created_by, r.created_at, r.archived_at,
+           (SELECT COUNT(*) FROM room_members m WHERE m.room_id = r.id),
+           EXISTS (SELECT 1 FROM room_members m WHERE m.room_id = r.id AND m.user_id = $1)
+    FROM rooms r
+    WHERE r.archived_at IS NULL
+    ORDER BY r.name`
+
+	rows, err := service.db.Query(ctx, listRoomsQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, scanRoom)
+}
+
+// GetRoom returns the room with its membership relative to the given user.
+func (service *RoomService) GetRoom(ctx context.Context, roomID int64, userID int64) (Room, error) {
+	getRoomQuery := `
+    SELECT r.id, r.name, r.created_by, r.created_at, r.archived_at,
+           (SELECT COUNT(*) FROM room_members m WHERE m.room_id = r.id),
+           EXISTS (SELECT 1 FROM room_members m WHERE m.room_id = r.id AND m.user_id = $2)
+    FROM rooms r
+    WHERE r.id = $1`
+
+	rows, err := service.db.Query(ctx, getRoomQuery, roomID, userID)
+	if err != nil {
+		return Room{}, err
+	}
+
+	room, err := pgx.CollectExactlyOneRow(rows, scanRoom)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Room{}, ErrRoomNotFound
+	}
+	return room, err
+}
+
+func (service *RoomService) GetRoomMembers(ctx context.Context, roomID int64) ([]RoomMember, error) {
+	getMembersQuery := `
+    SELECT u.id, u.username, ` + userNameColumn + `, m.joined_at
+    FROM room_members m
+    INNER JOIN users u ON u.id = m.user_id
+    WHERE m.room_id = $1 AND u.is_active = true
+    ORDER BY lower(` + userNameColumn + `), u.username`
+
+	rows, err := service.db.Query(ctx, getMembersQuery, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (RoomMember, error) {
+		var member RoomMember
+		err := row.Scan(&member.UserID, &member.Username, &member.Name, &member.JoinedAt)
+		return member, err
+	})
+}
+
+// JoinRoom adds the user to the room. Joining a room twice is not an error.
+func (service *RoomService) JoinRoom(ctx context.Context, roomID int64, userID int64) error {
+	room, err := service.GetRoom(ctx, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if room.IsArchived() {
+		return ErrRoomArchived
+	}
+
+	joinRoomQuery := `
+    INSERT INTO room_members (room_id, user_id)
+    VALUES ($1, $2)
+    ON CONFLICT DO NOTHING`
+
+	_, err = service.db.Exec(ctx, joinRoomQuery, roomID, userID)
+	return err
+}
+
+func (service *RoomService) LeaveRoom(ctx context.Context, roomID int64, userID int64) error {
+	leaveRoomQuery := `
+    DELETE FROM room_members
+    WHERE room_id = $1 AND user_id = $2`
+
+	tag, err := service.db.Exec(ctx, leaveRoomQuery, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotRoomMember
+	}
+	return nil
+}
+
+// ArchiveRoom makes the room read only. Only the user who created the room may archive it.
+func (service *RoomService) ArchiveRoom(ctx context.Context, roomID int64, userID int64) error {
+	room, err := service.GetRoom(ctx, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if !room.IsOwnedBy(userID) {
+		return ErrNotRoomOwner
+	}
+	if room.IsArchived() {
+		return nil
+	}
+
+	archiveRoomQuery := `
+    UPDATE rooms
+    SET archived_at = NOW()
+    WHERE id = $1 AND archived_at IS NULL`
+
+	_, err = service.db.Exec(ctx, archiveRoomQuery, roomID)
+	return err
+}
+
+func scanRoom(row pgx.CollectableRow) (Room, error) {
+	var room Room
+	err := row.Scan(
+		&room.ID,
+		&room.Name,
+		&room.CreatedBy,
+		&room.CreatedAt,
+		&room.ArchivedAt,
+		&room.MemberCount,
+		&room.IsMember,
+	)
+	return room, err
+}
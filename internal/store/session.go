@@ -2,13 +2,54 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"time"
+	"unicode/utf8"
 
 	"gochat/main/internal/models"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// SessionStore persists user sessions. Implementations must treat an expired session as missing.
+type SessionStore interface {
+	CreateSession(ctx context.Context, sessionID string, userID int64, expiresAt time.Time, metadata models.SessionMetadata) (models.Session, error)
+	// GetSession returns ErrSessionNotFound if there is no unexpired session with the id.
+	GetSession(ctx context.Context, sessionID string) (models.Session, error)
+	// DeleteSession does not return an error if the session does not exist.
+	DeleteSession(ctx context.Context, sessionID string) error
+	DeleteUserSessions(ctx context.Context, userID int64) error
+	// DeleteUserSession deletes the user's session with the hashed id. It returns ErrSessionNotFound
+	// if the user has no such session, so users can only ever revoke their own sessions.
+	DeleteUserSession(ctx context.Context, userID int64, sessionIDHash string) error
+	// DeleteUserSessionsExcept deletes every session of the user other than the one with the given id.
+	DeleteUserSessionsExcept(ctx context.Context, userID int64, keepSessionID string) error
+	// ListUserSessions returns the user's unexpired sessions, most recently seen first.
+	ListUserSessions(ctx context.Context, userID int64) ([]models.Session, error)
+	// TouchSession records the session was seen at lastSeenAt and moves its expiry,
+	// returning ErrSessionNotFound if there is no unexpired session with the id.
+	TouchSession(ctx context.Context, sessionID string, lastSeenAt time.Time, expiresAt time.Time) error
+	// DeleteExpiredSessions deletes up to limit expired sessions and returns how many were deleted.
+	// Stores which expire sessions on their own can always return zero.
+	DeleteExpiredSessions(ctx context.Context, limit int) (int64, error)
+	// CountActiveSessions returns the number of unexpired sessions across every user.
+	CountActiveSessions(ctx context.Context) (int64, error)
+}
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// HashSessionID returns the hex encoded SHA-256 of the session id, which is what stores persist.
+// A plain hash is enough since session ids are random with 128 bits of entropy, so they can not be
+// brute forced from the hash the way a password could.
+func HashSessionID(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:])
+}
+
+// SessionService is the Postgres backed SessionStore.
 type SessionService struct {
 	db *pgxpool.Pool
 }
@@ -19,37 +60,173 @@ func NewSessionService(db *pgxpool.Pool) SessionService {
 	}
 }
 
-// TODO: Make this session service DB session service and switch to
-// interface (think redis, or in memory in the future)!
-// TODO: Lets hash the session id.
-func (service *SessionService) CreateSession(ctx context.Context, sessionID string, userID int64, expiresAt time.Time) (models.Session, error) {
+func (service *SessionService) CreateSession(ctx context.Context, sessionID string, userID int64, expiresAt time.Time, metadata models.SessionMetadata) (models.Session, error) {
 	createSessionQuery := `
     INSERT INTO sessions (
-        session_id, 
-        user_id, 
-        expires_at
-    ) 
-    VALUES ($1, $2, $3)
-	  RETURNING *`
+        session_id_hash,
+        user_id,
+        expires_at,
+        user_agent,
+        ip_address
+    )
+    VALUES ($1, $2, $3, $4, $5)
+	  RETURNING ` + sessionColumns
 
-	var session models.Session
-	err := service.db.QueryRow(ctx, createSessionQuery, sessionID, userID, expiresAt).Scan(
-		&session.SessionID,
-		&session.UserID,
-		&session.ExpiresAt,
-		&session.CreatedAt,
+	rows, err := service.db.Query(ctx, createSessionQuery,
+		HashSessionID(sessionID),
+		userID,
+		expiresAt,
+		truncateUserAgent(metadata.UserAgent),
+		metadata.IPAddress,
 	)
 	if err != nil {
 		return models.Session{}, err
 	}
-	return session, nil
+	return pgx.CollectExactlyOneRow(rows, scanSession)
+}
+
+func (service *SessionService) GetSession(ctx context.Context, sessionID string) (models.Session, error) {
+	getSessionQuery := `
+    SELECT ` + sessionColumns + `
+    FROM sessions
+    WHERE session_id_hash = $1 AND expires_at > NOW()`
+
+	rows, err := service.db.Query(ctx, getSessionQuery, HashSessionID(sessionID))
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	session, err := pgx.CollectExactlyOneRow(rows, scanSession)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Session{}, ErrSessionNotFound
+	}
+	return session, err
+}
+
+func (service *SessionService) ListUserSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	listUserSessionsQuery := `
+    SELECT ` + sessionColumns + `
+    FROM sessions
+    WHERE user_id = $1 AND expires_at > NOW()
+    ORDER BY last_seen_at DESC`
+
+	rows, err := service.db.Query(ctx, listUserSessionsQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanSession)
+}
+
+func (service *SessionService) DeleteUserSession(ctx context.Context, userID int64, sessionIDHash string) error {
+	deleteUserSessionQuery := `
+    DELETE FROM sessions
+    WHERE user_id = $1 AND session_id_hash = $2`
+
+	tag, err := service.db.Exec(ctx, deleteUserSessionQuery, userID, sessionIDHash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (service *SessionService) DeleteUserSessionsExcept(ctx context.Context, userID int64, keepSessionID string) error {
+	deleteOtherSessionsQuery := `
+    DELETE FROM sessions
+    WHERE user_id = $1 AND session_id_hash <> $2`
+
+	_, err := service.db.Exec(ctx, deleteOtherSessionsQuery, userID, HashSessionID(keepSessionID))
+	return err
 }
 
 func (service *SessionService) DeleteSession(ctx context.Context, sessionID string) error {
 	deleteSessionQuery := `
-    DELETE FROM sessions 
-    WHERE session_id = $1`
+    DELETE FROM sessions
+    WHERE session_id_hash = $1`
+
+	_, err := service.db.Exec(ctx, deleteSessionQuery, HashSessionID(sessionID))
+	return err
+}
 
-	_, err := service.db.Exec(ctx, deleteSessionQuery, sessionID)
+func (service *SessionService) DeleteUserSessions(ctx context.Context, userID int64) error {
+	deleteUserSessionsQuery := `
+    DELETE FROM sessions
+    WHERE user_id = $1`
+
+	_, err := service.db.Exec(ctx, deleteUserSessionsQuery, userID)
 	return err
 }
+
+func (service *SessionService) TouchSession(ctx context.Context, sessionID string, lastSeenAt time.Time, expiresAt time.Time) error {
+	touchSessionQuery := `
+    UPDATE sessions
+    SET last_seen_at = $2, expires_at = $3
+    WHERE session_id_hash = $1 AND expires_at > NOW()`
+
+	tag, err := service.db.Exec(ctx, touchSessionQuery, HashSessionID(sessionID), lastSeenAt, expiresAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (service *SessionService) DeleteExpiredSessions(ctx context.Context, limit int) (int64, error) {
+	deleteExpiredSessionsQuery := `
+    DELETE FROM sessions
+    WHERE session_id_hash IN (
+        SELECT session_id_hash
+        FROM sessions
+        WHERE expires_at <= NOW()
+        LIMIT $1
+    )`
+
+	tag, err := service.db.Exec(ctx, deleteExpiredSessionsQuery, limit)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (service *SessionService) CountActiveSessions(ctx context.Context) (int64, error) {
+	countActiveSessionsQuery := `
+    SELECT COUNT(*)
+    FROM sessions
+    WHERE expires_at > NOW()`
+
+	var count int64
+	err := service.db.QueryRow(ctx, countActiveSessionsQuery).Scan(&count)
+	return count, err
+}
+
+const sessionColumns = "session_id_hash, user_id, expires_at, created_at, last_seen_at, user_agent, ip_address"
+
+func scanSession(row pgx.CollectableRow) (models.Session, error) {
+	var session models.Session
+	err := row.Scan(
+		&session.SessionIDHash,
+		&session.UserID,
+		&session.ExpiresAt,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.UserAgent,
+		&session.IPAddress,
+	)
+	return session, err
+}
+
+func truncateUserAgent(userAgent string) string {
+	if len(userAgent) <= models.MaxUserAgentLength {
+		return userAgent
+	}
+	// Back up to the start of a rune so the result is still valid UTF-8.
+	end := models.MaxUserAgentLength
+	for end > 0 && !utf8.RuneStart(userAgent[end]) {
+		end--
+	}
+	return userAgent[:end]
+}
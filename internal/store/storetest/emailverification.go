@@ -0,0 +1,108 @@
+package storetest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gochat/main/internal/store"
+)
+
+// EmailVerificationStore is an in-memory store.EmailVerificationStore which verifies the emails of
+// the users in a fake UserStore.
+type EmailVerificationStore struct {
+	mu     sync.Mutex
+	users  *UserStore
+	tokens map[string]verificationToken
+
+	// Err, when set, is returned by every method so tests can check how callers handle failures.
+	Err error
+}
+
+type verificationToken struct {
+	userID    int64
+	email     string
+	expiresAt time.Time
+}
+
+var _ store.EmailVerificationStore = (*EmailVerificationStore)(nil)
+
+func NewEmailVerificationStore(users *UserStore) *EmailVerificationStore {
+	return &EmailVerificationStore{
+		users:  users,
+		tokens: make(map[string]verificationToken),
+	}
+}
+
+// Tokens returns the number of stored tokens, used or not.
+func (fake *EmailVerificationStore) Tokens() int {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return len(fake.tokens)
+}
+
+func (fake *EmailVerificationStore) CreateEmailVerificationToken(ctx context.Context, token string, userID int64, email string, ttl time.Duration) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return fake.Err
+	}
+
+	fake.tokens[store.HashVerificationToken(token)] = verificationToken{userID: userID, email: email, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (fake *EmailVerificationStore) VerifyEmail(ctx context.Context, token string) (int64, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return 0, fake.Err
+	}
+
+	tokenHash := store.HashVerificationToken(token)
+	stored, ok := fake.tokens[tokenHash]
+	delete(fake.tokens, tokenHash)
+	if !ok || !stored.expiresAt.After(time.Now()) {
+		return 0, store.ErrVerificationTokenInvalid
+	}
+
+	isVerified, err := fake.users.verifyEmail(stored.userID, stored.email)
+	if err != nil {
+		return 0, err
+	}
+	if !isVerified {
+		return 0, store.ErrVerificationTokenInvalid
+	}
+
+	for otherHash, other := range fake.tokens {
+		if other.userID == stored.userID {
+			delete(fake.tokens, otherHash)
+		}
+	}
+	return stored.userID, nil
+}
+
+func (fake *EmailVerificationStore) DeleteExpiredEmailVerificationTokens(ctx context.Context, limit int) (int64, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return 0, fake.Err
+	}
+
+	now := time.Now()
+	var deleted int64
+	for tokenHash, stored := range fake.tokens {
+		if deleted >= int64(limit) {
+			break
+		}
+		if !stored.expiresAt.After(now) {
+			delete(fake.tokens, tokenHash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
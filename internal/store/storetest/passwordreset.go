@@ -0,0 +1,107 @@
+package storetest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gochat/main/internal/store"
+)
+
+// PasswordResetStore is an in-memory store.PasswordResetStore which resets the passwords of the
+// users in a fake UserStore.
+type PasswordResetStore struct {
+	mu     sync.Mutex
+	users  *UserStore
+	tokens map[string]resetToken
+
+	// Err, when set, is returned by every method so tests can check how callers handle failures.
+	Err error
+}
+
+type resetToken struct {
+	userID    int64
+	expiresAt time.Time
+}
+
+var _ store.PasswordResetStore = (*PasswordResetStore)(nil)
+
+func NewPasswordResetStore(users *UserStore) *PasswordResetStore {
+	return &PasswordResetStore{
+		users:  users,
+		tokens: make(map[string]resetToken),
+	}
+}
+
+// Tokens returns the number of stored tokens, used or not.
+func (fake *PasswordResetStore) Tokens() int {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return len(fake.tokens)
+}
+
+func (fake *PasswordResetStore) CreatePasswordResetToken(ctx context.Context, token string, userID int64, ttl time.Duration) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return fake.Err
+	}
+
+	fake.tokens[store.HashResetToken(token)] = resetToken{userID: userID, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (fake *PasswordResetStore) ResetPassword(ctx context.Context, token string, newPassword string) (int64, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return 0, fake.Err
+	}
+
+	tokenHash := store.HashResetToken(token)
+	stored, ok := fake.tokens[tokenHash]
+	delete(fake.tokens, tokenHash)
+	if !ok || !stored.expiresAt.After(time.Now()) {
+		return 0, store.ErrResetTokenInvalid
+	}
+
+	isActive, err := fake.users.setPassword(stored.userID, newPassword)
+	if err != nil {
+		return 0, err
+	}
+	if !isActive {
+		return 0, store.ErrResetTokenInvalid
+	}
+
+	for otherHash, other := range fake.tokens {
+		if other.userID == stored.userID {
+			delete(fake.tokens, otherHash)
+		}
+	}
+	return stored.userID, nil
+}
+
+func (fake *PasswordResetStore) DeleteExpiredPasswordResetTokens(ctx context.Context, limit int) (int64, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return 0, fake.Err
+	}
+
+	now := time.Now()
+	var deleted int64
+	for tokenHash, stored := range fake.tokens {
+		if deleted >= int64(limit) {
+			break
+		}
+		if !stored.expiresAt.After(now) {
+			delete(fake.tokens, tokenHash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,377 @@
+// Package storetest provides in-memory fakes of the store interfaces for tests.
+// Sessions need no fake since store.MemorySessionStore already keeps them in memory.
+package storetest
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"gochat/main/internal/store"
+	"gochat/main/internal/utils/passwords"
+)
+
+// UserStore is an in-memory store.UserStore. Passwords are kept in plain text unless Hashers is
+// set, so it must only ever be used in tests.
+type UserStore struct {
+	mu        sync.Mutex
+	nextID    int64
+	users     map[int64]store.User
+	passwords map[int64]string
+	// failedLogins and lockedUntil track lockouts like the users table's columns.
+	failedLogins map[int64]int
+	lockedUntil  map[int64]time.Time
+
+	// Err, when set, is returned by every method so tests can check how callers handle failures.
+	Err error
+	// Lockout is the policy applied to failed sign ins. The zero value never locks anyone out.
+	Lockout store.LockoutPolicy
+	// Hashers, when set, hash and verify passwords the way the real store does, including the dummy
+	// verification for unknown users, so timing tests see the real costs. Set it before adding users.
+	Hashers *passwords.Hashers
+}
+
+var _ store.UserStore = (*UserStore)(nil)
+
+func NewUserStore() *UserStore {
+	return &UserStore{
+		users:        make(map[int64]store.User),
+		passwords:    make(map[int64]string),
+		failedLogins: make(map[int64]int),
+		lockedUntil:  make(map[int64]time.Time),
+	}
+}
+
+// AddUser creates an active user, for setting up tests.
+func (fake *UserStore) AddUser(username string, password string) store.User {
+	user, err := fake.CreateUser(username, password, "", context.Background())
+	if err != nil {
+		panic(err)
+	}
+	return user
+}
+
+// Deactivate marks the user inactive, hiding them from every lookup like the real store does.
+func (fake *UserStore) Deactivate(userID int64) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	user := fake.users[userID]
+	user.IsActive = false
+	fake.users[userID] = user
+}
+
+// MarkEmailVerified verifies the user's current email, as following a verification link would, and
+// returns the updated user.
+func (fake *UserStore) MarkEmailVerified(userID int64) store.User {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	user := fake.users[userID]
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	fake.users[userID] = user
+	return user
+}
+
+// Users returns every user, active or not.
+func (fake *UserStore) Users() []store.User {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	users := make([]store.User, 0, len(fake.users))
+	for _, user := range fake.users {
+		users = append(users, user)
+	}
+	return users
+}
+
+func (fake *UserStore) CreateUser(username string, password string, email string, ctx context.Context) (store.User, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return store.User{}, fake.Err
+	}
+
+	// Usernames stay taken after deactivation, as they do in the database.
+	for _, user := range fake.users {
+		if user.Username == username {
+			return store.User{}, store.ErrUsernameTaken
+		}
+	}
+
+	if fake.Hashers != nil {
+		passHash, err := fake.Hashers.Hash(password)
+		if err != nil {
+			return store.User{}, err
+		}
+		password = passHash
+	}
+
+	fake.nextID++
+	signUpDate := time.Now().Truncate(24 * time.Hour)
+	user := store.User{
+		ID:         fake.nextID,
+		Username:   username,
+		SignUpDate: &signUpDate,
+		IsActive:   true,
+		Email:      email,
+	}
+	fake.users[user.ID] = user
+	fake.passwords[user.ID] = password
+	return user, nil
+}
+
+func (fake *UserStore) AuthenticateUser(ctx context.Context, username string, password string) (store.User, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return store.User{}, fake.Err
+	}
+
+	// Unknown users carry on with the zero user, who has no password.
+	user, isFound := fake.findActive(func(user store.User) bool { return user.Username == username })
+
+	now := time.Now()
+	isLocked := fake.lockedUntil[user.ID].After(now)
+	passwordHash := fake.passwords[user.ID]
+	if isLocked {
+		passwordHash = ""
+	}
+
+	doesMatch := isFound && passwordHash == password
+	if fake.Hashers != nil {
+		var err error
+		doesMatch, _, err = store.VerifyLoginPassword(*fake.Hashers, passwordHash, password)
+		if err != nil {
+			return store.User{}, err
+		}
+	}
+	if !isFound || isLocked {
+		return store.User{}, store.ErrInvalidCredentials
+	}
+	if !doesMatch {
+		fake.failedLogins[user.ID]++
+		if lockFor := fake.Lockout.Duration(fake.failedLogins[user.ID]); lockFor > 0 {
+			fake.lockedUntil[user.ID] = now.Add(lockFor)
+		}
+		return store.User{}, store.ErrInvalidCredentials
+	}
+
+	delete(fake.failedLogins, user.ID)
+	delete(fake.lockedUntil, user.ID)
+	return user, nil
+}
+
+func (fake *UserStore) GetUserByID(ctx context.Context, id int64) (store.User, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return store.User{}, fake.Err
+	}
+
+	user, ok := fake.findActive(func(user store.User) bool { return user.ID == id })
+	if !ok {
+		return store.User{}, store.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (fake *UserStore) GetUserByUsername(ctx context.Context, username string) (store.User, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return store.User{}, fake.Err
+	}
+
+	user, ok := fake.findActive(func(user store.User) bool { return user.Username == username })
+	if !ok {
+		return store.User{}, store.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (fake *UserStore) ChangePassword(ctx context.Context, userID int64, currentPassword string, newPassword string) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	err := fake.checkPassword(userID, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	if fake.Hashers != nil {
+		newPassword, err = fake.Hashers.Hash(newPassword)
+		if err != nil {
+			return err
+		}
+	}
+	fake.passwords[userID] = newPassword
+	return nil
+}
+
+func (fake *UserStore) UpdateDisplayName(ctx context.Context, userID int64, displayName string) (store.User, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return store.User{}, fake.Err
+	}
+
+	user, ok := fake.findActive(func(user store.User) bool { return user.ID == userID })
+	if !ok {
+		return store.User{}, store.ErrUserNotFound
+	}
+	user.DisplayName = displayName
+	fake.users[userID] = user
+	return user, nil
+}
+
+func (fake *UserStore) DeactivateUser(ctx context.Context, userID int64, password string) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	err := fake.checkPassword(userID, password)
+	if err != nil {
+		return err
+	}
+
+	user := fake.users[userID]
+	user.IsActive = false
+	fake.users[userID] = user
+	return nil
+}
+
+func (fake *UserStore) GetUserByEmail(ctx context.Context, email string) (store.User, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return store.User{}, fake.Err
+	}
+
+	user, ok := fake.findActive(func(user store.User) bool { return user.IsEmailVerified() && strings.EqualFold(user.Email, email) })
+	if !ok {
+		return store.User{}, store.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (fake *UserStore) UpdateEmail(ctx context.Context, userID int64, email string) (store.User, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return store.User{}, fake.Err
+	}
+
+	user, ok := fake.findActive(func(user store.User) bool { return user.ID == userID })
+	if !ok {
+		return store.User{}, store.ErrUserNotFound
+	}
+	if !strings.EqualFold(user.Email, email) {
+		user.EmailVerifiedAt = nil
+	}
+	user.Email = email
+	fake.users[userID] = user
+	return user, nil
+}
+
+// verifyEmail marks the user's email verified if it is still the given one, for
+// EmailVerificationStore.
+func (fake *UserStore) verifyEmail(userID int64, email string) (bool, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return false, fake.Err
+	}
+
+	user, ok := fake.findActive(func(user store.User) bool { return user.ID == userID })
+	if !ok || !strings.EqualFold(user.Email, email) {
+		return false, nil
+	}
+	// Verified emails stay taken after deactivation, as they do in the database.
+	for _, other := range fake.users {
+		if other.ID != userID && other.IsEmailVerified() && strings.EqualFold(other.Email, email) {
+			return false, store.ErrEmailTaken
+		}
+	}
+
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		fake.users[userID] = user
+	}
+	return true, nil
+}
+
+// setPassword replaces the user's password, clearing any lockout, for PasswordResetStore.
+func (fake *UserStore) setPassword(userID int64, password string) (bool, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return false, fake.Err
+	}
+
+	_, ok := fake.findActive(func(user store.User) bool { return user.ID == userID })
+	if !ok {
+		return false, nil
+	}
+
+	if fake.Hashers != nil {
+		passHash, err := fake.Hashers.Hash(password)
+		if err != nil {
+			return false, err
+		}
+		password = passHash
+	}
+	fake.passwords[userID] = password
+	delete(fake.failedLogins, userID)
+	delete(fake.lockedUntil, userID)
+	return true, nil
+}
+
+// checkPassword mirrors the real store's check of an active user's password.
+func (fake *UserStore) checkPassword(userID int64, password string) error {
+	if fake.Err != nil {
+		return fake.Err
+	}
+
+	_, ok := fake.findActive(func(user store.User) bool { return user.ID == userID })
+	if !ok {
+		return store.ErrUserNotFound
+	}
+
+	doesMatch, err := fake.passwordMatches(userID, password)
+	if err != nil {
+		return err
+	}
+	if !doesMatch {
+		return store.ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (fake *UserStore) passwordMatches(userID int64, password string) (bool, error) {
+	if fake.Hashers == nil {
+		return fake.passwords[userID] == password, nil
+	}
+	doesMatch, _, err := fake.Hashers.Verify(password, fake.passwords[userID])
+	return doesMatch, err
+}
+
+func (fake *UserStore) findActive(match func(user store.User) bool) (store.User, bool) {
+	for _, user := range fake.users {
+		if user.IsActive && match(user) {
+			return user, true
+		}
+	}
+	return store.User{}, false
+}
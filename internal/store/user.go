@@ -4,6 +4,7 @@ package store
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"time"
 
 	"gochat/main/internal/utils/passwords"
@@ -12,97 +13,433 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// UserStore persists users. Only active users can sign in or be looked up.
+type UserStore interface {
+	// CreateUser returns ErrUsernameTaken if a user already has the username. The email is optional
+	// and starts out unverified, so it may be one another user has.
+	// The user joins the general room.
+	CreateUser(username string, password string, email string, ctx context.Context) (User, error)
+	// AuthenticateUser returns ErrInvalidCredentials unless an active user has the username and password.
+	// Failed attempts count towards locking the user out, during which it returns ErrInvalidCredentials
+	// whatever the password, so a locked user can not be told apart from an unknown username.
+	AuthenticateUser(ctx context.Context, username string, password string) (User, error)
+	// GetUserByID returns ErrUserNotFound if there is no active user with the id.
+	GetUserByID(ctx context.Context, id int64) (User, error)
+	// GetUserByUsername returns ErrUserNotFound if there is no active user with the username.
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+	// GetUserByEmail returns ErrUserNotFound if there is no active user who has verified the email,
+	// which is matched regardless of case. Unverified emails may belong to someone else entirely.
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	// ChangePassword returns ErrInvalidCredentials if the current password is wrong and
+	// ErrUserNotFound if there is no active user with the id.
+	ChangePassword(ctx context.Context, userID int64, currentPassword string, newPassword string) error
+	// UpdateDisplayName returns ErrUserNotFound if there is no active user with the id. An empty
+	// display name shows the username instead.
+	UpdateDisplayName(ctx context.Context, userID int64, displayName string) (User, error)
+	// DeactivateUser returns ErrInvalidCredentials if the password is wrong and ErrUserNotFound if
+	// there is no active user with the id. The username stays taken.
+	DeactivateUser(ctx context.Context, userID int64, password string) error
+	// UpdateEmail returns ErrUserNotFound if there is no active user with the id. An empty email
+	// removes it. A different email is no longer verified, while changing only its case keeps it
+	// verified.
+	UpdateEmail(ctx context.Context, userID int64, email string) (User, error)
+}
+
+// verifiedEmailIndex is the unique index on users' verified emails. Unverified ones are not unique,
+// so nobody can hold on to an email they do not own.
+const verifiedEmailIndex = "users_verified_email_idx"
+
+var (
+	ErrInvalidCredentials = errors.New("no user with the following credentials found")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUsernameTaken      = errors.New("username is taken")
+	ErrEmailTaken         = errors.New("email is verified by another user")
+)
+
+// LockoutPolicy locks a user out after Threshold consecutive failed sign ins. The lockout lasts
+// BaseDuration and doubles with every further failure, up to MaxDuration, so guessing slows to a
+// crawl while the owner is only briefly inconvenienced by a few typos. A zero Threshold disables it.
+type LockoutPolicy struct {
+	Threshold    int
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+}
+
+// Duration returns how long the user is locked out after the number of consecutive failures.
+func (policy LockoutPolicy) Duration(failures int) time.Duration {
+	if policy.Threshold <= 0 || failures < policy.Threshold {
+		return 0
+	}
+
+	duration := policy.BaseDuration
+	for range failures - policy.Threshold {
+		duration *= 2
+		if duration >= policy.MaxDuration {
+			return policy.MaxDuration
+		}
+	}
+	return min(duration, policy.MaxDuration)
+}
+
+// VerifyLoginPassword checks a password given to sign in against the user's hash. When no active
+// user has the username passwordHash is empty, and the password is checked against the dummy hash
+// instead, so turning away unknown and deactivated users takes as long as a wrong password and the
+// response time does not give away which usernames are registered. Every UserStore which hashes
+// passwords must check sign ins with it.
+func VerifyLoginPassword(hashers passwords.Hashers, passwordHash string, password string) (doesMatch bool, needsRehash bool, err error) {
+	if passwordHash == "" {
+		hashers.VerifyDummy(password)
+		return false, false, nil
+	}
+	return hashers.Verify(password, passwordHash)
+}
+
+// UserService is the Postgres backed UserStore.
 type UserService struct {
 	db *pgxpool.Pool
+	// hashers hash new passwords and upgrade outdated hashes as users sign in.
+	hashers passwords.Hashers
+	lockout LockoutPolicy
 }
 
-func NewUserService(db *pgxpool.Pool) UserService {
+func NewUserService(db *pgxpool.Pool, hashers passwords.Hashers, lockout LockoutPolicy) UserService {
 	return UserService{
-		db: db,
+		db:      db,
+		hashers: hashers,
+		lockout: lockout,
 	}
 }
 
+var _ UserStore = (*UserService)(nil)
+
 type User struct {
 	ID           int64
 	Username     string
 	passwordHash string
 	SignUpDate   *time.Time
 	IsActive     bool
+	DisplayName  string
+	// Email is empty when the user has not given one.
+	Email string
+	// EmailVerifiedAt is when the user followed the link emailed to Email, nil until they have.
+	EmailVerifiedAt *time.Time
 }
 
-func (store *UserService) CreateUser(username string, password string, context context.Context) (User, error) {
-	passHash, err := passwords.CreatePasswordHash(password, passwords.DefaultArgon2Params)
-	if err != nil {
-		return User{}, err
-	}
+// userColumns are the columns scanUser reads, in order.
+// userNameColumn selects the name shown for the user joined as u, like User.Name.
+const userNameColumn = `COALESCE(NULLIF(u.display_name, ''), u.username)`
 
-	query := "INSERT INTO users (username, password_hash) VALUES ($1, $2) RETURNING *"
+const userColumns = `id, username, password_hash, sign_up_date, is_active, display_name, COALESCE(email, ''), email_verified_at`
 
+// scanUser reads a row of userColumns, followed by any extra columns into extra.
+func scanUser(row pgx.Row, extra ...any) (User, error) {
 	var user User
-	err = store.db.QueryRow(context, query, username, passHash).Scan(
+	dest := []any{
 		&user.ID,
 		&user.Username,
 		&user.passwordHash,
 		&user.SignUpDate,
 		&user.IsActive,
-	)
+		&user.DisplayName,
+		&user.Email,
+		&user.EmailVerifiedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return user, err
+}
+
+// Name is what the user is shown as, their display name if they set one.
+func (user User) Name() string {
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	return user.Username
+}
+
+// IsEmailVerified reports whether the user has an email and has shown they own it.
+func (user User) IsEmailVerified() bool {
+	return user.Email != "" && user.EmailVerifiedAt != nil
+}
+
+func (store *UserService) CreateUser(username string, password string, email string, context context.Context) (User, error) {
+	passHash, err := store.hashers.Hash(password)
 	if err != nil {
 		return User{}, err
 	}
 
-	return user, nil
-}
+	tx, err := store.db.Begin(context)
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback(context)
 
-var ErrInvalidCredentials = errors.New("no user with the following credentials found")
+	query := `INSERT INTO users (username, password_hash, email) VALUES ($1, $2, NULLIF($3::text, ''))
+	          RETURNING ` + userColumns
+
+	user, err := scanUser(tx.QueryRow(context, query, username, passHash, email))
+	if err != nil {
+		// The username is the only unique field of a new user, whose email is not verified yet.
+		if isUniqueViolation(err) {
+			return User{}, ErrUsernameTaken
+		}
+		return User{}, err
+	}
+
+	// Everyone starts in the general room, like the users it was created with.
+	joinGeneralRoomQuery := `
+    INSERT INTO room_members (room_id, user_id)
+    SELECT id, $2 FROM rooms WHERE name = $1 AND archived_at IS NULL`
+
+	_, err = tx.Exec(context, joinGeneralRoomQuery, GeneralRoomName, user.ID)
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, tx.Commit(context)
+}
 
 func (store *UserService) AuthenticateUser(ctx context.Context, username string, password string) (User, error) {
-	getUserFromUsernameQuery := `SELECT *
+	// The lockout is worked out against the database clock, which also sets it.
+	getUserFromUsernameQuery := `SELECT ` + userColumns + `, failed_login_count,
+	                                    COALESCE(locked_until > NOW(), false)
 	                                FROM users
 	                                WHERE username = $1 AND users.is_active = true`
-	var user User
-	err := store.db.QueryRow(ctx, getUserFromUsernameQuery, username).Scan(
-		&user.ID,
-		&user.Username,
-		&user.passwordHash,
-		&user.SignUpDate,
-		&user.IsActive,
-	)
+	var failedLoginCount int
+	var isLocked bool
+	user, err := scanUser(store.db.QueryRow(ctx, getUserFromUsernameQuery, username), &failedLoginCount, &isLocked)
+	// Unknown and deactivated users carry on with an empty hash, so they are verified like anyone.
+	isFound := !errors.Is(err, pgx.ErrNoRows)
+	if err != nil && isFound {
+		return User{}, err
+	}
+
+	// A locked user is checked against the dummy hash too and turned away like an unknown one, so
+	// neither the answer nor the time it takes shows the username is registered.
+	passwordHash := user.passwordHash
+	if isLocked {
+		passwordHash = ""
+	}
+	doesMatch, needsRehash, err := VerifyLoginPassword(store.hashers, passwordHash, password)
 	if err != nil {
+		return User{}, err
+	}
+	if !isFound || isLocked || !doesMatch {
+		// Unknown and locked users are counted against nobody, which still runs the same queries
+		// as counting a wrong password so the time taken does not give them away either.
+		failedUserID := user.ID
+		if isLocked {
+			failedUserID = 0
+		}
+		err = store.recordFailedLogin(ctx, failedUserID)
+		if err != nil {
+			return User{}, err
+		}
+		return User{}, ErrInvalidCredentials
+	}
 
-		if errors.Is(err, pgx.ErrNoRows) {
-			return User{}, ErrInvalidCredentials
+	if failedLoginCount > 0 {
+		resetFailedLoginsQuery := `UPDATE users SET failed_login_count = 0, locked_until = NULL WHERE id = $1`
+		_, err = store.db.Exec(ctx, resetFailedLoginsQuery, user.ID)
+		if err != nil {
+			return User{}, err
 		}
+	}
+
+	if needsRehash {
+		// The user is signed in either way, so a failure only means trying again next time.
+		err = store.rehashPassword(ctx, user, password)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to upgrade password hash", "user_id", user.ID, "err", err)
+		}
+	}
+	return user, nil
+}
+
+// rehashPassword replaces the user's password hash with one made by the preferred hasher. It is
+// left alone if the password has changed since it was checked.
+func (store *UserService) rehashPassword(ctx context.Context, user User, password string) error {
+	newHash, err := store.hashers.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	rehashPasswordQuery := `UPDATE users SET password_hash = $2 WHERE id = $1 AND password_hash = $3`
+	_, err = store.db.Exec(ctx, rehashPasswordQuery, user.ID, newHash, user.passwordHash)
+	return err
+}
+
+// recordFailedLogin counts a failed sign in, locking the user out if it takes them past the
+// policy's threshold. The count is incremented by the database, so guesses made at the same time
+// each count rather than all reading the same count and writing one more. A zero userID counts
+// against nobody. Both queries run every time, so every failure takes as long.
+func (store *UserService) recordFailedLogin(ctx context.Context, userID int64) error {
+	countFailedLoginQuery := `
+    UPDATE users
+    SET failed_login_count = failed_login_count + 1
+    WHERE id = $1
+    RETURNING failed_login_count`
+
+	var failures int
+	err := store.db.QueryRow(ctx, countFailedLoginQuery, userID).Scan(&failures)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	// Left alone if the count has moved on, since whoever moved it sets a lockout at least as long.
+	lockOutQuery := `
+    UPDATE users
+    SET locked_until = NOW() + make_interval(secs => $3::float8)
+    WHERE id = $1 AND failed_login_count = $2 AND $3::float8 > 0`
+
+	lockFor := store.lockout.Duration(failures)
+	_, err = store.db.Exec(ctx, lockOutQuery, userID, failures, lockFor.Seconds())
+	return err
+}
+
+// GetUserByID returns the active user with the given id.
+func (store *UserService) GetUserByID(ctx context.Context, id int64) (User, error) {
+	getUserQuery := `SELECT ` + userColumns + `
+	                   FROM users
+	                   WHERE id = $1 AND is_active = true`
+
+	user, err := scanUser(store.db.QueryRow(ctx, getUserQuery, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
 		return User{}, err
 	}
 
-	doesMatch, err := passwords.DoesPasswordMatchHashedPassword(password, user.passwordHash)
+	return user, nil
+}
+
+// GetUserByUsername returns the active user with the given username.
+func (store *UserService) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	getUserQuery := `SELECT ` + userColumns + `
+	                   FROM users
+	                   WHERE username = $1 AND is_active = true`
+
+	user, err := scanUser(store.db.QueryRow(ctx, getUserQuery, username))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
 	if err != nil {
 		return User{}, err
 	}
 
-	if doesMatch {
-		return user, nil
-	} else {
-		return User{}, ErrInvalidCredentials
+	return user, nil
+}
+
+// ChangePassword replaces the active user's password once the current one has been checked.
+func (store *UserService) ChangePassword(ctx context.Context, userID int64, currentPassword string, newPassword string) error {
+	err := store.checkPassword(ctx, userID, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	passHash, err := store.hashers.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	changePasswordQuery := `UPDATE users SET password_hash = $2 WHERE id = $1 AND is_active = true`
+	tag, err := store.db.Exec(ctx, changePasswordQuery, userID, passHash)
+	if err != nil {
+		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
 }
 
-// GetUserFromSessionID returns the user attached to the given session id given they have
-// a valid session currently in the db.
-func (store *UserService) GetUserFromSessionID(ctx context.Context, id string) (User, error) {
-	joinSessionAndUserQuery := `SELECT u.id, u.username, u.password_hash, u.sign_up_date, u.is_active
-	          FROM sessions s 
-	          INNER JOIN users u ON u.id = s.user_id 
-	          WHERE s.session_id = $1 AND s.expires_at > NOW() AND u.is_active = true`
+// UpdateDisplayName sets the active user's display name, returning the updated user.
+func (store *UserService) UpdateDisplayName(ctx context.Context, userID int64, displayName string) (User, error) {
+	updateDisplayNameQuery := `UPDATE users SET display_name = $2
+	                             WHERE id = $1 AND is_active = true
+	                             RETURNING ` + userColumns
 
-	var user User
-	err := store.db.QueryRow(ctx, joinSessionAndUserQuery, id).Scan(
-		&user.ID,
-		&user.Username,
-		&user.passwordHash,
-		&user.SignUpDate,
-		&user.IsActive,
-	)
+	user, err := scanUser(store.db.QueryRow(ctx, updateDisplayNameQuery, userID, displayName))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// DeactivateUser marks the active user inactive once their password has been checked.
+func (store *UserService) DeactivateUser(ctx context.Context, userID int64, password string) error {
+	err := store.checkPassword(ctx, userID, password)
+	if err != nil {
+		return err
+	}
+
+	deactivateUserQuery := `UPDATE users SET is_active = false WHERE id = $1 AND is_active = true`
+	tag, err := store.db.Exec(ctx, deactivateUserQuery, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// checkPassword returns ErrInvalidCredentials unless the password is the active user's.
+func (store *UserService) checkPassword(ctx context.Context, userID int64, password string) error {
+	getPasswordHashQuery := `SELECT password_hash FROM users WHERE id = $1 AND is_active = true`
+
+	var passwordHash string
+	err := store.db.QueryRow(ctx, getPasswordHashQuery, userID).Scan(&passwordHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	doesMatch, _, err := store.hashers.Verify(password, passwordHash)
+	if err != nil {
+		return err
+	}
+	if !doesMatch {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// GetUserByEmail returns the active user who has verified the given email.
+func (store *UserService) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	getUserQuery := `SELECT ` + userColumns + `
+	                   FROM users
+	                   WHERE lower(email) = lower($1) AND email_verified_at IS NOT NULL AND is_active = true`
+
+	user, err := scanUser(store.db.QueryRow(ctx, getUserQuery, email))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// UpdateEmail sets the active user's email, returning the updated user.
+func (store *UserService) UpdateEmail(ctx context.Context, userID int64, email string) (User, error) {
+	updateEmailQuery := `UPDATE users
+	                       SET email = NULLIF($2::text, ''),
+	                           email_verified_at = CASE WHEN lower(email) = lower($2::text) THEN email_verified_at END
+	                       WHERE id = $1 AND is_active = true
+	                       RETURNING ` + userColumns
+
+	user, err := scanUser(store.db.QueryRow(ctx, updateEmailQuery, userID, email))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
 	if err != nil {
 		return User{}, err
 	}
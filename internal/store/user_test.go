@@ -0,0 +1,352 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gochat/main/internal/utils/passwords"
+)
+
+// countingHasher keeps passwords in plain text and counts how many it verifies, so tests can
+// check every sign in pays for a verification.
+type countingHasher struct {
+	verified *atomic.Int64
+}
+
+func (hasher countingHasher) Hash(password string) (string, error) {
+	return "plain$" + password, nil
+}
+
+func (hasher countingHasher) Identifies(hashString string) bool {
+	return strings.HasPrefix(hashString, "plain$")
+}
+
+func (hasher countingHasher) Verify(password string, hashString string) (bool, bool, error) {
+	hasher.verified.Add(1)
+	return hashString == "plain$"+password, false, nil
+}
+
+// newCountingHashers returns hashers which count into the returned counter. Making the dummy hash
+// is not a verification, so it starts at zero.
+func newCountingHashers(t *testing.T) (passwords.Hashers, *atomic.Int64) {
+	t.Helper()
+
+	verified := &atomic.Int64{}
+	hashers, err := passwords.NewHashers(countingHasher{verified: verified})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hashers, verified
+}
+
+func TestLockoutPolicyDuration(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 3, BaseDuration: time.Minute, MaxDuration: 10 * time.Minute}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Minute},
+		{failures: 4, want: 2 * time.Minute},
+		{failures: 6, want: 8 * time.Minute},
+		{failures: 7, want: 10 * time.Minute},
+		{failures: 1000, want: 10 * time.Minute},
+	}
+
+	for _, test := range tests {
+		if got := policy.Duration(test.failures); got != test.want {
+			t.Errorf("Duration(%d) = %s, want %s", test.failures, got, test.want)
+		}
+	}
+
+	if got := (LockoutPolicy{}).Duration(1000); got != 0 {
+		t.Errorf("disabled policy locked out for %s", got)
+	}
+}
+
+func TestUserServiceCreateUserJoinsGeneralRoom(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserService(db, testHashers(t), LockoutPolicy{})
+	rooms := NewRoomService(db)
+	ctx := context.Background()
+
+	user, err := users.CreateUser(uniqueName("user"), "password123", "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := rooms.ListRooms(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, room := range list {
+		if room.Name == GeneralRoomName {
+			if !room.IsMember {
+				t.Error("new user is not a member of the general room")
+			}
+			return
+		}
+	}
+	t.Fatal("no general room")
+}
+
+func TestVerifyLoginPassword(t *testing.T) {
+	tests := []struct {
+		name         string
+		passwordHash string
+		password     string
+		wantMatch    bool
+	}{
+		{name: "right password", passwordHash: "plain$password123", password: "password123", wantMatch: true},
+		{name: "wrong password", passwordHash: "plain$password123", password: "password321"},
+		{name: "no user", passwordHash: "", password: "password123"},
+		{name: "no user and no password", passwordHash: "", password: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hashers, verified := newCountingHashers(t)
+
+			doesMatch, _, err := VerifyLoginPassword(hashers, test.passwordHash, test.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doesMatch != test.wantMatch {
+				t.Errorf("match = %t, want %t", doesMatch, test.wantMatch)
+			}
+			if got := verified.Load(); got != 1 {
+				t.Errorf("verified %d passwords, want 1 so every sign in takes as long", got)
+			}
+		})
+	}
+}
+
+func TestUserServiceAuthenticateUserVerifiesEveryAttempt(t *testing.T) {
+	db := newTestDB(t)
+	hashers, verified := newCountingHashers(t)
+	users := NewUserService(db, hashers, LockoutPolicy{Threshold: 2, BaseDuration: time.Hour, MaxDuration: time.Hour})
+	ctx := context.Background()
+
+	user, err := users.CreateUser(uniqueName("user"), "password123", "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked, err := users.CreateUser(uniqueName("locked"), "password123", "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		_, err = users.AuthenticateUser(ctx, locked.Username, "wrong-password")
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("locking out err = %v, want ErrInvalidCredentials", err)
+		}
+	}
+	deactivated, err := users.CreateUser(uniqueName("deactivated"), "password123", "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = users.DeactivateUser(ctx, deactivated.ID, "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username string
+		password string
+	}{
+		{username: user.Username, password: "wrong-password"},
+		{username: uniqueName("nobody"), password: "password123"},
+		{username: deactivated.Username, password: "password123"},
+		// Even the right password is turned away like the rest while locked out.
+		{username: locked.Username, password: "password123"},
+	}
+
+	for _, test := range tests {
+		verified.Store(0)
+		_, err = users.AuthenticateUser(ctx, test.username, test.password)
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("signing in as %q err = %v, want ErrInvalidCredentials", test.username, err)
+		}
+		if got := verified.Load(); got != 1 {
+			t.Errorf("signing in as %q verified %d passwords, want 1", test.username, got)
+		}
+	}
+}
+
+// TestUserServiceAuthenticateUserTiming checks that turning away an unknown, deactivated or locked
+// user costs the same queries, and so about the same time, as a wrong password. The passwords are
+// not hashed, so the database is all there is to time.
+func TestUserServiceAuthenticateUserTiming(t *testing.T) {
+	db, counter := newCountingTestDB(t)
+	hashers, _ := newCountingHashers(t)
+	users := NewUserService(db, hashers, LockoutPolicy{Threshold: 1000, BaseDuration: time.Hour, MaxDuration: time.Hour})
+	ctx := context.Background()
+
+	registered, err := users.CreateUser(uniqueName("user"), "password123", "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked, err := users.CreateUser(uniqueName("locked"), "password123", "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(ctx, "UPDATE users SET locked_until = NOW() + INTERVAL '1 hour' WHERE id = $1", locked.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deactivated, err := users.CreateUser(uniqueName("deactivated"), "password123", "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = users.DeactivateUser(ctx, deactivated.ID, "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The wrong password for a registered user is what the others are held up against.
+	usernames := []string{registered.Username, uniqueName("nobody"), deactivated.Username, locked.Username}
+	queries := make(map[string]int64)
+	durations := make(map[string][]time.Duration)
+	// Taking turns spreads any slow patch on the machine across every case.
+	for range 31 {
+		for _, username := range usernames {
+			before := counter.queries.Load()
+			start := time.Now()
+			_, err := users.AuthenticateUser(ctx, username, "wrong-password")
+			durations[username] = append(durations[username], time.Since(start))
+			queries[username] = counter.queries.Load() - before
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("signing in as %q err = %v, want ErrInvalidCredentials", username, err)
+			}
+		}
+	}
+
+	wrongPassword := medianDuration(durations[registered.Username])
+	for _, username := range usernames[1:] {
+		if queries[username] != queries[registered.Username] {
+			t.Errorf("signing in as %q ran %d queries, but a wrong password ran %d", username, queries[username], queries[registered.Username])
+		}
+		got := medianDuration(durations[username])
+		ratio := float64(got) / float64(wrongPassword)
+		if ratio < 0.75 || ratio > 1.33 {
+			t.Errorf("signing in as %q took %v, but a wrong password took %v", username, got, wrongPassword)
+		}
+	}
+}
+
+func medianDuration(durations []time.Duration) time.Duration {
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
+
+func TestUserServiceGetUserByEmailNeedsVerifiedEmail(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserService(db, testHashers(t), LockoutPolicy{})
+	verifications := NewEmailVerificationService(db)
+	ctx := context.Background()
+
+	email := uniqueName("user") + "@example.com"
+	user, err := users.CreateUser(uniqueName("user"), "password123", email, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = users.GetUserByEmail(ctx, email)
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserByEmail before verifying = %v, want %v", err, ErrUserNotFound)
+	}
+
+	token := uniqueName("token")
+	err = verifications.CreateEmailVerificationToken(ctx, token, user.ID, email, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = verifications.VerifyEmail(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := users.GetUserByEmail(ctx, strings.ToUpper(email))
+	if err != nil || found.ID != user.ID {
+		t.Errorf("GetUserByEmail after verifying = %d, %v, want %d", found.ID, err, user.ID)
+	}
+}
+
+func TestUserServiceOnlyVerifiedEmailsAreUnique(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserService(db, testHashers(t), LockoutPolicy{})
+	verifications := NewEmailVerificationService(db)
+	ctx := context.Background()
+
+	// Nobody can keep the email from its owner by giving it first.
+	email := uniqueName("user") + "@example.com"
+	squatter, err := users.CreateUser(uniqueName("user"), "password123", email, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, err := users.CreateUser(uniqueName("user"), "password123", strings.ToUpper(email), ctx)
+	if err != nil {
+		t.Fatalf("CreateUser with an unverified email of another user: %v", err)
+	}
+
+	verify := func(user User) error {
+		token := uniqueName("token")
+		err := verifications.CreateEmailVerificationToken(ctx, token, user.ID, user.Email, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = verifications.VerifyEmail(ctx, token)
+		return err
+	}
+	err = verify(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = verify(squatter)
+	if !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("verifying an email another user verified = %v, want %v", err, ErrEmailTaken)
+	}
+}
+
+func TestUserServiceAuthenticateUserCountsConcurrentFailures(t *testing.T) {
+	db := newTestDB(t)
+	hashers, _ := newCountingHashers(t)
+	const guesses = 8
+	// Only the last of the guesses reaches the threshold, so the lockout shows every one counted.
+	users := NewUserService(db, hashers, LockoutPolicy{Threshold: guesses, BaseDuration: time.Hour, MaxDuration: time.Hour})
+	ctx := context.Background()
+
+	user, err := users.CreateUser(uniqueName("user"), "password123", "", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for range guesses {
+		wg.Go(func() {
+			_, err := users.AuthenticateUser(ctx, user.Username, "wrong-password")
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("wrong password err = %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	var failures int
+	var isLocked bool
+	err = db.QueryRow(ctx, "SELECT failed_login_count, COALESCE(locked_until > NOW(), false) FROM users WHERE id = $1", user.ID).Scan(&failures, &isLocked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failures != guesses || !isLocked {
+		t.Errorf("after %d concurrent guesses failures = %d, locked = %t, want %d and locked", guesses, failures, isLocked, guesses)
+	}
+}
@@ -18,50 +18,95 @@ type Argon2IdParams struct {
 	Threads uint8
 }
 
-// DefaultArgon2Params should reflect OSWAP minimum recs: https://cheatsheetseries.owasp.org/cheatsheets/Password_Storage_Cheat_Sheet.html
-var DefaultArgon2Params = Argon2IdParams{
-	Time:    2,
-	Memory:  19 * 1024,
-	Threads: 1,
+const (
+	saltLength = 16
+	keyLength  = 32
+)
+
+// Argon2IdHasher hashes passwords with argon2id, in the PHC string format.
+type Argon2IdHasher struct {
+	// Params are used for new hashes. Hashes made with any others are due to be rehashed.
+	Params Argon2IdParams
+}
+
+var _ Hasher = Argon2IdHasher{}
+
+func NewArgon2IdHasher(params Argon2IdParams) Argon2IdHasher {
+	return Argon2IdHasher{Params: params}
+}
+
+func (hasher Argon2IdHasher) Hash(password string) (string, error) {
+	return CreatePasswordHash(password, hasher.Params)
+}
+
+func (hasher Argon2IdHasher) Identifies(hashString string) bool {
+	return strings.HasPrefix(hashString, "$argon2id$")
+}
+
+// Verify also asks for a rehash when the hash was made with other parameters, an older version
+// of argon2 or a different salt or key length than new hashes get.
+func (hasher Argon2IdHasher) Verify(password string, hashString string) (bool, bool, error) {
+	parsed, err := parseArgon2IdHash(hashString)
+	if err != nil {
+		return false, false, err
+	}
+
+	hashedPass := argon2.IDKey(
+		[]byte(password),
+		parsed.salt,
+		parsed.params.Time,
+		parsed.params.Memory,
+		parsed.params.Threads,
+		uint32(len(parsed.hash)))
+
+	doesMatch := subtle.ConstantTimeCompare(hashedPass, parsed.hash) == 1
+	needsRehash := parsed.version != argon2.Version ||
+		parsed.params != hasher.Params ||
+		len(parsed.salt) != saltLength ||
+		len(parsed.hash) != keyLength
+	return doesMatch, doesMatch && needsRehash, nil
 }
 
-func DoesPasswordMatchHashedPassword(password string, hashString string) (bool, error) {
+// argon2IdHash is a stored hash split into its parts.
+type argon2IdHash struct {
+	version int
+	params  Argon2IdParams
+	salt    []byte
+	hash    []byte
+}
+
+func parseArgon2IdHash(hashString string) (argon2IdHash, error) {
 	parts := strings.Split(hashString, "$")
 
 	if len(parts) != 6 {
-		return false, errors.New("hash string does not have six parts")
+		return argon2IdHash{}, errors.New("hash string does not have six parts")
 	}
 
-	// Skip the version.
+	var parsed argon2IdHash
+	_, err := fmt.Sscanf(parts[2], "v=%d", &parsed.version)
+	if err != nil {
+		return argon2IdHash{}, errors.New("failed to extract the version from hash")
+	}
 
 	// Time, Memory, & Threads
-	params := Argon2IdParams{}
-	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &parsed.params.Memory, &parsed.params.Time, &parsed.params.Threads)
 	if err != nil {
-		return false, errors.New("failed to extract time memory and threads from hash")
+		return argon2IdHash{}, errors.New("failed to extract time memory and threads from hash")
 	}
 
 	// Salt
-	existingSalt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	parsed.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
 	if err != nil {
-		return false, errors.New("failed to base64 decode the salt")
+		return argon2IdHash{}, errors.New("failed to base64 decode the salt")
 	}
 
 	// Hash
-	existingHash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	parsed.hash, err = base64.RawStdEncoding.DecodeString(parts[5])
 	if err != nil {
-		return false, errors.New("failed to base64 decode the hash")
+		return argon2IdHash{}, errors.New("failed to base64 decode the hash")
 	}
 
-	hashedPass := argon2.IDKey(
-		[]byte(password),
-		existingSalt,
-		params.Time,
-		params.Memory,
-		params.Threads,
-		uint32(len(existingHash)))
-
-	return subtle.ConstantTimeCompare(hashedPass, existingHash) == 1, nil
+	return parsed, nil
 }
 
 func CreatePasswordHash(password string, params Argon2IdParams) (string, error) {
@@ -76,7 +121,7 @@ func CreatePasswordHash(password string, params Argon2IdParams) (string, error)
 		params.Time,
 		params.Memory,
 		params.Threads,
-		32)
+		keyLength)
 
 	hashAsBase64String := base64.RawStdEncoding.EncodeToString(hashBytes)
 	saltAsBase64String := base64.RawStdEncoding.EncodeToString(salt)
@@ -89,7 +134,7 @@ func CreatePasswordHash(password string, params Argon2IdParams) (string, error)
 
 // generateSalt creates a 16-byte cryptographically secure random salt.
 func generateSalt() ([]byte, error) {
-	salt := make([]byte, 16)
+	salt := make([]byte, saltLength)
 	_, err := rand.Read(salt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate salt: %w", err)
@@ -0,0 +1,116 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultBcryptCost is the cost below which bcrypt hashes are rehashed.
+const DefaultBcryptCost = bcrypt.DefaultCost
+
+var ErrUnknownHashScheme = errors.New("password hash is not in a known scheme")
+
+// Hasher is a password hashing scheme.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Identifies reports whether the hash was made by this scheme.
+	Identifies(hashString string) bool
+	// Verify reports whether the password matches the hash and, if it does, whether the hash
+	// should be replaced because it was made with weaker settings than new hashes get.
+	Verify(password string, hashString string) (doesMatch bool, needsRehash bool, err error)
+}
+
+// Hashers hashes new passwords with a preferred scheme while still verifying hashes made by
+// older ones, so users can be moved over as they sign in.
+type Hashers struct {
+	preferred Hasher
+	legacy    []Hasher
+	// dummyHash is a hash of a random password, made up front for VerifyDummy.
+	dummyHash string
+}
+
+// NewHashers fails if the dummy hash can not be made, rather than leave VerifyDummy returning
+// straight away.
+func NewHashers(preferred Hasher, legacy ...Hasher) (Hashers, error) {
+	// The password is thrown away, so nothing can ever match the hash.
+	dummyPassword := make([]byte, 32)
+	_, err := rand.Read(dummyPassword)
+	if err != nil {
+		return Hashers{}, fmt.Errorf("generating dummy password: %w", err)
+	}
+	dummyHash, err := preferred.Hash(string(dummyPassword))
+	if err != nil {
+		return Hashers{}, fmt.Errorf("hashing dummy password: %w", err)
+	}
+
+	return Hashers{
+		preferred: preferred,
+		legacy:    legacy,
+		dummyHash: dummyHash,
+	}, nil
+}
+
+// VerifyDummy takes as long as verifying a password against a hash from the preferred hasher.
+// Call it when there is no user to check the password against, otherwise answering quickly gives
+// away that nobody has the username.
+func (hashers Hashers) VerifyDummy(password string) {
+	hashers.preferred.Verify(password, hashers.dummyHash)
+}
+
+// Hash hashes the password with the preferred scheme.
+func (hashers Hashers) Hash(password string) (string, error) {
+	return hashers.preferred.Hash(password)
+}
+
+// Verify checks the password with whichever scheme made the hash. A matching hash from a legacy
+// scheme always needs rehashing.
+func (hashers Hashers) Verify(password string, hashString string) (bool, bool, error) {
+	if hashers.preferred.Identifies(hashString) {
+		return hashers.preferred.Verify(password, hashString)
+	}
+
+	for _, hasher := range hashers.legacy {
+		if hasher.Identifies(hashString) {
+			doesMatch, _, err := hasher.Verify(password, hashString)
+			return doesMatch, doesMatch, err
+		}
+	}
+	return false, false, ErrUnknownHashScheme
+}
+
+// BcryptHasher verifies bcrypt hashes, such as those imported from another system.
+type BcryptHasher struct {
+	// Cost is used for new hashes. Hashes made with a lower cost are due to be rehashed.
+	Cost int
+}
+
+var _ Hasher = BcryptHasher{}
+
+func (hasher BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), hasher.Cost)
+	return string(hash), err
+}
+
+func (hasher BcryptHasher) Identifies(hashString string) bool {
+	_, err := bcrypt.Cost([]byte(hashString))
+	return err == nil
+}
+
+func (hasher BcryptHasher) Verify(password string, hashString string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hashString), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	cost, err := bcrypt.Cost([]byte(hashString))
+	if err != nil {
+		return false, false, err
+	}
+	return true, cost < hasher.Cost, nil
+}
@@ -0,0 +1,123 @@
+package passwords
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashersVerify(t *testing.T) {
+	// Tiny parameters keep the test fast, they are far too weak for real use.
+	current := Argon2IdParams{Time: 1, Memory: 64, Threads: 1}
+	outdated := Argon2IdParams{Time: 1, Memory: 32, Threads: 1}
+	hashers, err := NewHashers(NewArgon2IdHasher(current), BcryptHasher{Cost: bcrypt.MinCost + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := func(hasher Hasher) string {
+		t.Helper()
+		hashString, err := hasher.Hash("password123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hashString
+	}
+
+	tests := []struct {
+		name            string
+		hashString      string
+		password        string
+		wantMatch       bool
+		wantNeedsRehash bool
+		wantErr         error
+	}{
+		{
+			name:       "matches a current hash",
+			hashString: hash(NewArgon2IdHasher(current)),
+			password:   "password123",
+			wantMatch:  true,
+		},
+		{
+			name:       "rejects the wrong password",
+			hashString: hash(NewArgon2IdHasher(current)),
+			password:   "password321",
+		},
+		{
+			name:            "rehashes a hash with outdated parameters",
+			hashString:      hash(NewArgon2IdHasher(outdated)),
+			password:        "password123",
+			wantMatch:       true,
+			wantNeedsRehash: true,
+		},
+		{
+			name:       "does not rehash for the wrong password",
+			hashString: hash(NewArgon2IdHasher(outdated)),
+			password:   "password321",
+		},
+		{
+			name:            "rehashes a legacy bcrypt hash",
+			hashString:      hash(BcryptHasher{Cost: bcrypt.MinCost + 1}),
+			password:        "password123",
+			wantMatch:       true,
+			wantNeedsRehash: true,
+		},
+		{
+			name:       "rejects the wrong password for a bcrypt hash",
+			hashString: hash(BcryptHasher{Cost: bcrypt.MinCost + 1}),
+			password:   "password321",
+		},
+		{
+			name:       "refuses an unknown scheme",
+			hashString: "$scrypt$ln=16,r=8,p=1$c2FsdA$aGFzaA",
+			password:   "password123",
+			wantErr:    ErrUnknownHashScheme,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doesMatch, needsRehash, err := hashers.Verify(test.password, test.hashString)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("err = %v, want %v", err, test.wantErr)
+			}
+			if doesMatch != test.wantMatch || needsRehash != test.wantNeedsRehash {
+				t.Errorf("match = %t, needs rehash = %t, want %t and %t", doesMatch, needsRehash, test.wantMatch, test.wantNeedsRehash)
+			}
+		})
+	}
+}
+
+func TestBcryptHasherRehashesLowCost(t *testing.T) {
+	hashString, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doesMatch, needsRehash, err := BcryptHasher{Cost: bcrypt.MinCost + 1}.Verify("password123", hashString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !doesMatch || !needsRehash {
+		t.Errorf("match = %t, needs rehash = %t, want both", doesMatch, needsRehash)
+	}
+}
+
+// failingHasher can not hash anything.
+type failingHasher struct {
+	BcryptHasher
+}
+
+var errHashFailed = errors.New("hash failed")
+
+func (failingHasher) Hash(password string) (string, error) {
+	return "", errHashFailed
+}
+
+func TestNewHashersFailsWithoutDummyHash(t *testing.T) {
+	_, err := NewHashers(failingHasher{})
+	if !errors.Is(err, errHashFailed) {
+		t.Errorf("err = %v, want %v", err, errHashFailed)
+	}
+}
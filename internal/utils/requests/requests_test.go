@@ -0,0 +1,114 @@
+package requests
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		forwardedFor   []string
+		wantIP         string
+		noneAreTrusted bool
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:51234",
+			wantIP:     "203.0.113.7",
+		},
+		{
+			name:         "header from an untrusted client is ignored",
+			remoteAddr:   "203.0.113.7:51234",
+			forwardedFor: []string{"198.51.100.1"},
+			wantIP:       "203.0.113.7",
+		},
+		{
+			name:           "header is ignored when no proxies are trusted",
+			remoteAddr:     "10.0.0.2:51234",
+			forwardedFor:   []string{"198.51.100.1"},
+			wantIP:         "10.0.0.2",
+			noneAreTrusted: true,
+		},
+		{
+			name:         "client behind a trusted proxy",
+			remoteAddr:   "10.0.0.2:51234",
+			forwardedFor: []string{"198.51.100.1"},
+			wantIP:       "198.51.100.1",
+		},
+		{
+			name:       "trusted proxy without the header",
+			remoteAddr: "192.0.2.1:51234",
+			wantIP:     "192.0.2.1",
+		},
+		{
+			name:         "address made up by the client is skipped",
+			remoteAddr:   "10.0.0.2:51234",
+			forwardedFor: []string{"1.1.1.1, 198.51.100.1"},
+			wantIP:       "198.51.100.1",
+		},
+		{
+			name:         "chain of trusted proxies",
+			remoteAddr:   "10.0.0.2:51234",
+			forwardedFor: []string{"198.51.100.1, 192.0.2.1", "10.0.0.3"},
+			wantIP:       "198.51.100.1",
+		},
+		{
+			name:         "every hop trusted",
+			remoteAddr:   "10.0.0.2:51234",
+			forwardedFor: []string{"10.0.0.4, 10.0.0.3"},
+			wantIP:       "10.0.0.4",
+		},
+		{
+			name:         "garbage stops at the last address",
+			remoteAddr:   "10.0.0.2:51234",
+			forwardedFor: []string{"198.51.100.1, not-an-ip, 10.0.0.3"},
+			wantIP:       "10.0.0.3",
+		},
+		{
+			name:         "IPv6 client behind a trusted IPv6 proxy",
+			remoteAddr:   "[2001:db8::1]:51234",
+			forwardedFor: []string{"2001:db9::5"},
+			wantIP:       "2001:db9::5",
+		},
+		{
+			name:         "IPv4 mapped proxy address",
+			remoteAddr:   "[::ffff:10.0.0.2]:51234",
+			forwardedFor: []string{"198.51.100.1"},
+			wantIP:       "198.51.100.1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			for _, header := range test.forwardedFor {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+
+			trusted := proxies
+			if test.noneAreTrusted {
+				trusted = nil
+			}
+			if got := trusted.ClientIP(r); got != test.wantIP {
+				t.Errorf("ClientIP = %q, want %q", got, test.wantIP)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, value := range []string{"10.0.0.0/33", "10.0.0", "proxy.internal", ""} {
+		_, err := ParseTrustedProxies([]string{value})
+		if err == nil {
+			t.Errorf("ParseTrustedProxies(%q) did not fail", value)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+// Package resp provides a small client for servers speaking the Redis serialization protocol (RESP),
+// such as Redis, Valkey or KeyDB. It only implements what the stores need, not the full command set.
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNil is returned for a nil bulk string or array, e.g. GET on a missing key.
+var ErrNil = errors.New("resp: nil reply")
+
+// Error is an error reply sent by the server.
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+type Options struct {
+	// Password is sent with AUTH after connecting when it is not empty.
+	Password string
+	// DB is selected after connecting when it is not zero.
+	DB          int
+	DialTimeout time.Duration
+	// CommandTimeout bounds each round trip whose context has no deadline, so a server which stops
+	// answering can not hold the connection, and every caller waiting for it, forever.
+	CommandTimeout time.Duration
+}
+
+// Client sends commands over a single connection which is dialed lazily and redialed after errors.
+// Commands are serialised, so it is safe for concurrent use.
+type Client struct {
+	addr    string
+	options Options
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+func NewClient(addr string, options Options) *Client {
+	if options.DialTimeout == 0 {
+		options.DialTimeout = 5 * time.Second
+	}
+	if options.CommandTimeout == 0 {
+		options.CommandTimeout = 5 * time.Second
+	}
+
+	return &Client{
+		addr:    addr,
+		options: options,
+	}
+}
+
+// Do sends a single command and returns its reply.
+// Replies are decoded as string, int64, nil or []any for arrays.
+func (client *Client) Do(ctx context.Context, args ...string) (any, error) {
+	replies, err := client.Pipeline(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// Pipeline sends every command before reading any reply and returns the replies in order.
+// An error reply to one command is returned as that command's reply rather than failing the pipeline.
+func (client *Client) Pipeline(ctx context.Context, commands ...[]string) ([]any, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	err := client.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := client.roundTrip(ctx, commands)
+	if err != nil {
+		// The connection is in an unknown state, so start over on the next command.
+		client.close()
+		return nil, err
+	}
+	return replies, nil
+}
+
+// Close closes the underlying connection.
+func (client *Client) Close() error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	return client.close()
+}
+
+func (client *Client) connect(ctx context.Context) error {
+	if client.conn != nil {
+		return nil
+	}
+
+	dialer := net.Dialer{Timeout: client.options.DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", client.addr)
+	if err != nil {
+		return err
+	}
+
+	client.conn = conn
+	client.reader = bufio.NewReader(conn)
+	client.writer = bufio.NewWriter(conn)
+
+	var setup [][]string
+	if client.options.Password != "" {
+		setup = append(setup, []string{"AUTH", client.options.Password})
+	}
+	if client.options.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(client.options.DB)})
+	}
+	if len(setup) == 0 {
+		return nil
+	}
+
+	replies, err := client.roundTrip(ctx, setup)
+	if err == nil {
+		for _, reply := range replies {
+			if replyErr, ok := reply.(error); ok {
+				err = replyErr
+				break
+			}
+		}
+	}
+	if err != nil {
+		client.close()
+		return fmt.Errorf("resp: failed to set up connection: %w", err)
+	}
+	return nil
+}
+
+func (client *Client) close() error {
+	if client.conn == nil {
+		return nil
+	}
+
+	err := client.conn.Close()
+	client.conn = nil
+	client.reader = nil
+	client.writer = nil
+	return err
+}
+
+func (client *Client) roundTrip(ctx context.Context, commands [][]string) ([]any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(client.options.CommandTimeout)
+	}
+	err := client.conn.SetDeadline(deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, command := range commands {
+		writeCommand(client.writer, command)
+	}
+	err = client.writer.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make([]any, len(commands))
+	for i := range commands {
+		reply, err := readReply(client.reader)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// writeCommand encodes the command as an array of bulk strings.
+func writeCommand(writer *bufio.Writer, args []string) {
+	fmt.Fprintf(writer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// readReply decodes a single reply. Error replies are returned as an Error value, not as err,
+// so a failing command does not poison the rest of a pipeline.
+func readReply(reader *bufio.Reader) (any, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("resp: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+
+	case '-':
+		return Error(line[1:]), nil
+
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("resp: invalid bulk string length: %w", err)
+		}
+		if length < 0 {
+			return nil, nil
+		}
+
+		data := make([]byte, length+2)
+		_, err = io.ReadFull(reader, data)
+		if err != nil {
+			return nil, err
+		}
+		return string(data[:length]), nil
+
+	case '*':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("resp: invalid array length: %w", err)
+		}
+		if length < 0 {
+			return nil, nil
+		}
+
+		values := make([]any, length)
+		for i := range values {
+			values[i], err = readReply(reader)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+
+	default:
+		return nil, fmt.Errorf("resp: unknown reply type %q", line[0])
+	}
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errors.New("resp: malformed line")
+	}
+	return line[:len(line)-2], nil
+}
+
+// String converts a reply to a string, returning ErrNil for nil replies and the reply for error replies.
+func String(reply any, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+
+	switch value := reply.(type) {
+	case string:
+		return value, nil
+	case nil:
+		return "", ErrNil
+	case Error:
+		return "", value
+	default:
+		return "", fmt.Errorf("resp: unexpected reply type %T for string", reply)
+	}
+}
+
+// Int converts a reply to an integer, returning the reply for error replies.
+func Int(reply any, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	switch value := reply.(type) {
+	case int64:
+		return value, nil
+	case string:
+		return strconv.ParseInt(value, 10, 64)
+	case nil:
+		return 0, ErrNil
+	case Error:
+		return 0, value
+	default:
+		return 0, fmt.Errorf("resp: unexpected reply type %T for integer", reply)
+	}
+}
+
+// Strings converts an array reply to a slice of strings, returning the reply for error replies.
+func Strings(reply any, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	switch value := reply.(type) {
+	case []any:
+		values := make([]string, len(value))
+		for i, item := range value {
+			values[i], err = String(item, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case nil:
+		return nil, ErrNil
+	case Error:
+		return nil, value
+	default:
+		return nil, fmt.Errorf("resp: unexpected reply type %T for array", reply)
+	}
+}
+
+// StringMap converts a flat array of field value pairs, as returned by HGETALL, to a map.
+func StringMap(reply any, err error) (map[string]string, error) {
+	values, err := Strings(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, errors.New("resp: expected an even number of values for a map")
+	}
+
+	fields := make(map[string]string, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		fields[values[i]] = values[i+1]
+	}
+	return fields, nil
+}
@@ -0,0 +1,184 @@
+package resp_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gochat/main/internal/utils/resp"
+	"gochat/main/internal/utils/resp/resptest"
+)
+
+// replyServer returns the address of a server which answers every connection with the raw reply.
+func replyServer(t *testing.T, reply string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				// Wait for the command before answering it.
+				_, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil {
+					return
+				}
+				conn.Write([]byte(reply))
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestClientDecodesReplies(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  any
+	}{
+		{name: "simple string", reply: "+OK\r\n", want: "OK"},
+		{name: "error", reply: "-ERR wrong type\r\n", want: resp.Error("ERR wrong type")},
+		{name: "integer", reply: ":-42\r\n", want: int64(-42)},
+		{name: "bulk string", reply: "$5\r\nhe\r\no\r\n", want: "he\r\no"},
+		{name: "empty bulk string", reply: "$0\r\n\r\n", want: ""},
+		{name: "nil bulk string", reply: "$-1\r\n", want: nil},
+		{name: "nil array", reply: "*-1\r\n", want: nil},
+		{name: "array", reply: "*3\r\n$1\r\na\r\n:1\r\n$-1\r\n", want: []any{"a", int64(1), nil}},
+		{name: "nested array", reply: "*2\r\n$1\r\n0\r\n*1\r\n$3\r\nkey\r\n", want: []any{"0", []any{"key"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := resp.NewClient(replyServer(t, test.reply), resp.Options{})
+			defer client.Close()
+
+			got, err := client.Do(context.Background(), "PING")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("reply = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestClientRejectsMalformedReplies(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+	}{
+		{name: "unknown type", reply: "?what\r\n"},
+		{name: "missing carriage return", reply: "+OK\n"},
+		{name: "invalid integer", reply: ":one\r\n"},
+		{name: "invalid bulk string length", reply: "$five\r\nhello\r\n"},
+		{name: "truncated bulk string", reply: "$10\r\nhello"},
+		{name: "truncated array", reply: "*2\r\n:1\r\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := resp.NewClient(replyServer(t, test.reply), resp.Options{})
+			defer client.Close()
+
+			got, err := client.Do(context.Background(), "PING")
+			if err == nil {
+				t.Errorf("reply = %#v, want an error", got)
+			}
+		})
+	}
+}
+
+func TestClientPipelineKeepsErrorReplies(t *testing.T) {
+	server := resptest.NewServer(t)
+	client := resp.NewClient(server.Addr(), resp.Options{})
+	defer client.Close()
+
+	replies, err := client.Pipeline(context.Background(),
+		[]string{"SADD", "set", "a"},
+		[]string{"NOPE"},
+		[]string{"SMEMBERS", "set"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 3 {
+		t.Fatalf("got %d replies, want 3", len(replies))
+	}
+	if _, ok := replies[1].(resp.Error); !ok {
+		t.Errorf("reply to an unknown command = %#v, want an error reply", replies[1])
+	}
+	members, err := resp.Strings(replies[2], nil)
+	if err != nil || !reflect.DeepEqual(members, []string{"a"}) {
+		t.Errorf("SMEMBERS = %v, %v, want [a]", members, err)
+	}
+
+	// The error reply is returned by the converters.
+	_, err = resp.Int(replies[1], nil)
+	var replyErr resp.Error
+	if !errors.As(err, &replyErr) || !strings.HasPrefix(string(replyErr), "ERR unknown command") {
+		t.Errorf("Int err = %v, want the error reply", err)
+	}
+}
+
+func TestClientAuthenticates(t *testing.T) {
+	server := resptest.NewServer(t)
+	server.SetPassword("secret")
+
+	client := resp.NewClient(server.Addr(), resp.Options{Password: "secret"})
+	defer client.Close()
+	reply, err := resp.String(client.Do(context.Background(), "PING"))
+	if err != nil || reply != "PONG" {
+		t.Errorf("PING = %q, %v, want PONG", reply, err)
+	}
+
+	wrongClient := resp.NewClient(server.Addr(), resp.Options{Password: "wrong"})
+	defer wrongClient.Close()
+	_, err = wrongClient.Do(context.Background(), "PING")
+	if err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("err = %v, want the WRONGPASS reply", err)
+	}
+}
+
+func TestClientTimesOutWithoutDeadline(t *testing.T) {
+	// The server accepts connections but never answers.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	client := resp.NewClient(listener.Addr().String(), resp.Options{CommandTimeout: 50 * time.Millisecond})
+	defer client.Close()
+
+	start := time.Now()
+	_, err = client.Do(context.Background(), "PING")
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("err = %v, want a deadline exceeded error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("command took %s to time out", elapsed)
+	}
+}
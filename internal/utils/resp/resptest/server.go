@@ -0,0 +1,499 @@
+// Package resptest provides an in-memory server speaking RESP for testing code built on the resp
+// client without a real Redis. It only knows the commands the stores use.
+package resptest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gochat/main/internal/utils/resp"
+)
+
+// Status is a simple string reply, such as OK.
+type Status string
+
+// Script stands in for a Lua script sent with EVAL, which the server can not run. It is given call
+// to run commands the way redis.call would, and like a real script nothing else runs until it returns.
+type Script func(call func(args ...string) any, keys []string, args []string) any
+
+// Server is an in-memory RESP server listening on a loopback port.
+type Server struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	hashes   map[string]map[string]string
+	sets     map[string]map[string]bool
+	expiries map[string]time.Time
+	scripts  map[string]Script
+	now      func() time.Time
+	password string
+	conns    map[net.Conn]bool
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server which is closed when the test finishes.
+func NewServer(t testing.TB) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &Server{
+		listener: listener,
+		hashes:   make(map[string]map[string]string),
+		sets:     make(map[string]map[string]bool),
+		expiries: make(map[string]time.Time),
+		scripts:  make(map[string]Script),
+		now:      time.Now,
+		conns:    make(map[net.Conn]bool),
+	}
+	server.wg.Add(1)
+	go server.accept()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Addr is the address to connect to.
+func (server *Server) Addr() string {
+	return server.listener.Addr().String()
+}
+
+// Close stops the server and closes every connection.
+func (server *Server) Close() {
+	server.listener.Close()
+	server.mu.Lock()
+	server.closed = true
+	for conn := range server.conns {
+		conn.Close()
+	}
+	server.mu.Unlock()
+	server.wg.Wait()
+}
+
+// SetPassword makes clients AUTH with the password before running any other command.
+func (server *Server) SetPassword(password string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.password = password
+}
+
+// SetClock replaces the clock used to expire keys, so tests can move time along.
+func (server *Server) SetClock(now func() time.Time) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.now = now
+}
+
+// HandleScript runs the Script whenever EVAL is sent the script's source.
+func (server *Server) HandleScript(source string, script Script) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.scripts[source] = script
+}
+
+// TTL returns how long until the key expires, and false if it does not exist or never expires.
+func (server *Server) TTL(key string) (time.Duration, bool) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if !server.exists(key) {
+		return 0, false
+	}
+	expiresAt, ok := server.expiries[key]
+	return expiresAt.Sub(server.now()), ok
+}
+
+// Exists reports whether the key exists and has not expired.
+func (server *Server) Exists(key string) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return server.exists(key)
+}
+
+func (server *Server) accept() {
+	defer server.wg.Done()
+
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		server.mu.Lock()
+		if server.closed {
+			server.mu.Unlock()
+			conn.Close()
+			return
+		}
+		server.conns[conn] = true
+		server.mu.Unlock()
+
+		server.wg.Add(1)
+		go server.serve(conn)
+	}
+}
+
+// connState is what the server remembers about a connection between commands.
+type connState struct {
+	isAuthed bool
+	// queue holds the commands sent since MULTI, nil outside a transaction.
+	queue [][]string
+}
+
+func (server *Server) serve(conn net.Conn) {
+	defer server.wg.Done()
+	defer func() {
+		server.mu.Lock()
+		delete(server.conns, conn)
+		server.mu.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	var state connState
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		server.mu.Lock()
+		reply := server.handle(&state, args)
+		server.mu.Unlock()
+
+		writeReply(writer, reply)
+		if reader.Buffered() == 0 {
+			err = writer.Flush()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handle runs a command sent by a client, with the lock held.
+func (server *Server) handle(state *connState, args []string) any {
+	name := strings.ToUpper(args[0])
+
+	if name == "AUTH" {
+		if len(args) != 2 || args[1] != server.password {
+			return resp.Error("WRONGPASS invalid password")
+		}
+		state.isAuthed = true
+		return Status("OK")
+	}
+	if server.password != "" && !state.isAuthed {
+		return resp.Error("NOAUTH Authentication required.")
+	}
+
+	switch name {
+	case "MULTI":
+		state.queue = [][]string{}
+		return Status("OK")
+	case "EXEC":
+		if state.queue == nil {
+			return resp.Error("ERR EXEC without MULTI")
+		}
+		results := make([]any, len(state.queue))
+		for i, queued := range state.queue {
+			results[i] = server.call(queued...)
+		}
+		state.queue = nil
+		return results
+	}
+
+	if state.queue != nil {
+		state.queue = append(state.queue, args)
+		return Status("QUEUED")
+	}
+	return server.call(args...)
+}
+
+// call runs a single command, with the lock held.
+func (server *Server) call(args ...string) any {
+	name := strings.ToUpper(args[0])
+	args = args[1:]
+
+	switch name {
+	case "PING":
+		return Status("PONG")
+	case "SELECT":
+		return Status("OK")
+	case "EXISTS":
+		var count int64
+		for _, key := range args {
+			if server.exists(key) {
+				count++
+			}
+		}
+		return count
+	case "DEL":
+		var count int64
+		for _, key := range args {
+			if server.exists(key) {
+				count++
+			}
+			server.delete(key)
+		}
+		return count
+	case "PEXPIREAT":
+		if len(args) != 2 {
+			return wrongArgs(name)
+		}
+		millis, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return resp.Error("ERR value is not an integer or out of range")
+		}
+		if !server.exists(args[0]) {
+			return int64(0)
+		}
+		server.expiries[args[0]] = time.UnixMilli(millis)
+		return int64(1)
+	case "PTTL":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		if !server.exists(args[0]) {
+			return int64(-2)
+		}
+		expiresAt, ok := server.expiries[args[0]]
+		if !ok {
+			return int64(-1)
+		}
+		return expiresAt.Sub(server.now()).Milliseconds()
+	case "HSET":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return wrongArgs(name)
+		}
+		hash := server.hash(args[0], true)
+		var added int64
+		for i := 1; i < len(args); i += 2 {
+			if _, ok := hash[args[i]]; !ok {
+				added++
+			}
+			hash[args[i]] = args[i+1]
+		}
+		return added
+	case "HGET":
+		if len(args) != 2 {
+			return wrongArgs(name)
+		}
+		value, ok := server.hash(args[0], false)[args[1]]
+		if !ok {
+			return nil
+		}
+		return value
+	case "HGETALL":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		fields := []any{}
+		for field, value := range server.hash(args[0], false) {
+			fields = append(fields, field, value)
+		}
+		return fields
+	case "SADD":
+		if len(args) < 2 {
+			return wrongArgs(name)
+		}
+		set := server.set(args[0], true)
+		var added int64
+		for _, member := range args[1:] {
+			if !set[member] {
+				added++
+			}
+			set[member] = true
+		}
+		return added
+	case "SREM":
+		if len(args) < 2 {
+			return wrongArgs(name)
+		}
+		set := server.set(args[0], false)
+		var removed int64
+		for _, member := range args[1:] {
+			if set[member] {
+				removed++
+				delete(set, member)
+			}
+		}
+		if len(set) == 0 {
+			server.delete(args[0])
+		}
+		return removed
+	case "SMEMBERS":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		members := []any{}
+		for member := range server.set(args[0], false) {
+			members = append(members, member)
+		}
+		return members
+	case "SCAN":
+		// Everything comes back in one page, which callers must handle anyway.
+		pattern := "*"
+		for i := 1; i+1 < len(args); i += 2 {
+			if strings.EqualFold(args[i], "MATCH") {
+				pattern = args[i+1]
+			}
+		}
+		keys := []any{}
+		for _, key := range server.keys() {
+			if ok, _ := path.Match(pattern, key); ok {
+				keys = append(keys, key)
+			}
+		}
+		return []any{"0", keys}
+	case "EVAL":
+		if len(args) < 2 {
+			return wrongArgs(name)
+		}
+		script, ok := server.scripts[args[0]]
+		if !ok {
+			return resp.Error("ERR resptest does not know this script")
+		}
+		keyCount, err := strconv.Atoi(args[1])
+		if err != nil || keyCount < 0 || keyCount > len(args)-2 {
+			return resp.Error("ERR invalid number of keys")
+		}
+		return script(server.call, args[2:2+keyCount], args[2+keyCount:])
+	default:
+		return resp.Error(fmt.Sprintf("ERR unknown command '%s'", name))
+	}
+}
+
+func wrongArgs(name string) resp.Error {
+	return resp.Error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+}
+
+// exists reports whether the key exists, first dropping it if it has expired.
+func (server *Server) exists(key string) bool {
+	if expiresAt, ok := server.expiries[key]; ok && !expiresAt.After(server.now()) {
+		server.delete(key)
+	}
+	_, isHash := server.hashes[key]
+	_, isSet := server.sets[key]
+	return isHash || isSet
+}
+
+func (server *Server) delete(key string) {
+	delete(server.hashes, key)
+	delete(server.sets, key)
+	delete(server.expiries, key)
+}
+
+func (server *Server) keys() []string {
+	var keys []string
+	for key := range server.hashes {
+		if server.exists(key) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range server.sets {
+		if server.exists(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (server *Server) hash(key string, create bool) map[string]string {
+	if !server.exists(key) && create {
+		server.hashes[key] = make(map[string]string)
+	}
+	return server.hashes[key]
+}
+
+func (server *Server) set(key string, create bool) map[string]bool {
+	if !server.exists(key) && create {
+		server.sets[key] = make(map[string]bool)
+	}
+	return server.sets[key]
+}
+
+// readCommand reads a command sent as an array of bulk strings, as the resp client sends them.
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("resptest: expected an array, got %q", line)
+	}
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("resptest: invalid array length %q", line)
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		line, err = readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("resptest: expected a bulk string, got %q", line)
+		}
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 {
+			return nil, fmt.Errorf("resptest: invalid bulk string length %q", line)
+		}
+
+		data := make([]byte, length+2)
+		_, err = io.ReadFull(reader, data)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:length])
+	}
+	return args, nil
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", errors.New("resptest: malformed line")
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+func writeReply(writer *bufio.Writer, reply any) {
+	switch value := reply.(type) {
+	case Status:
+		fmt.Fprintf(writer, "+%s\r\n", value)
+	case resp.Error:
+		fmt.Fprintf(writer, "-%s\r\n", value)
+	case int64:
+		fmt.Fprintf(writer, ":%d\r\n", value)
+	case string:
+		fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(value), value)
+	case nil:
+		writer.WriteString("$-1\r\n")
+	case []any:
+		fmt.Fprintf(writer, "*%d\r\n", len(value))
+		for _, item := range value {
+			writeReply(writer, item)
+		}
+	default:
+		panic(fmt.Sprintf("resptest: can not encode reply of type %T", reply))
+	}
+}
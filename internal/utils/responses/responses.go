@@ -3,8 +3,9 @@ package responses
 
 import (
 	"bytes"
+	"encoding/json"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"gochat/main/internal/store"
@@ -17,6 +18,13 @@ import (
 // It will first render and the template in its entirety, then write that to the response writer
 // if it is successful.
 func RenderTemplate(w http.ResponseWriter, r *http.Request, templates *template.Template, name string, data map[string]any) {
+	renderTemplate(w, r, templates, name, data, 0)
+}
+
+// renderTemplate renders the template with the status, which is left to whatever the caller wrote
+// when zero. The status is only written once the template has rendered, so a failure can still
+// answer with a plain error instead.
+func renderTemplate(w http.ResponseWriter, r *http.Request, templates *template.Template, name string, data map[string]any, status int) {
 	if data == nil {
 		data = make(map[string]any)
 	}
@@ -30,20 +38,43 @@ func RenderTemplate(w http.ResponseWriter, r *http.Request, templates *template.
 
 	err := templates.ExecuteTemplate(&buf, name, data)
 	if err != nil {
-		log.Printf("Template execution error: %v", err)
+		slog.ErrorContext(r.Context(), "Template execution error", "template", name, "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	if status != 0 {
+		w.WriteHeader(status)
+	}
 	_, err = buf.WriteTo(w)
 	if err != nil {
-		log.Printf("Failed to write response: %v", err)
+		slog.WarnContext(r.Context(), "Failed to write response", "err", err)
 	}
 }
 
 // RenderInternalErrorOnTemplate will display a red banner stating an internal server error
-// above whatever passed template.
+// above whatever passed template, with a 500 status.
 func RenderInternalErrorOnTemplate(w http.ResponseWriter, r *http.Request, templates *template.Template, name string, data map[string]any) {
 	data["isShowingInternalError"] = true
-	RenderTemplate(w, r, templates, name, data)
+	renderTemplate(w, r, templates, name, data, http.StatusInternalServerError)
+}
+
+// WriteJSON encodes data as the JSON body of the response with the given status code.
+// Like RenderTemplate it encodes into a buffer first so a failure does not send a partial body.
+func WriteJSON(w http.ResponseWriter, status int, data any) {
+	var buf bytes.Buffer
+
+	err := json.NewEncoder(&buf).Encode(data)
+	if err != nil {
+		slog.Error("JSON encoding error", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = buf.WriteTo(w)
+	if err != nil {
+		slog.Warn("Failed to write response", "err", err)
+	}
 }
@@ -8,37 +8,94 @@ import (
 	"time"
 )
 
-const SessionCookieName string = "goChatSessionID"
+// CookieOptions controls the attributes of the session cookie.
+type CookieOptions struct {
+	Name string
+	// Secure stops browsers sending the cookie over plain HTTP. Browsers treat localhost as secure,
+	// so it only needs turning off to test over HTTP from another machine.
+	Secure bool
+}
+
+var DefaultCookieOptions = CookieOptions{
+	Name:   "goChatSessionID",
+	Secure: true,
+}
+
+// cookieOptions are used for every session cookie.
+var cookieOptions = DefaultCookieOptions
+
+// ConfigureCookies sets the options used for every session cookie.
+// It must be called before the server starts handling requests.
+func ConfigureCookies(options CookieOptions) {
+	cookieOptions = options
+}
+
+// CookieName returns the name of the session cookie.
+func CookieName() string {
+	return cookieOptions.Name
+}
 
 type ContextKey string
 
 const (
-	UserContextKey ContextKey = "User"
+	UserContextKey    ContextKey = "User"
+	SessionContextKey ContextKey = "Session"
 )
 
-func CreateSessionCookie() (http.Cookie, error) {
+// Policy controls how long sessions last.
+// A session expires after IdleTimeout without use, and after AbsoluteLifetime no matter how much it is used.
+type Policy struct {
+	IdleTimeout      time.Duration
+	AbsoluteLifetime time.Duration
+	// RenewInterval is the minimum time between renewals of a session, so that an active user
+	// does not cause a write to the session store on every request.
+	RenewInterval time.Duration
+}
+
+// ExpiresAt returns when a session created at createdAt and last used at now should expire.
+func (policy Policy) ExpiresAt(createdAt time.Time, now time.Time) time.Time {
+	idleExpiry := now.Add(policy.IdleTimeout)
+	absoluteExpiry := createdAt.Add(policy.AbsoluteLifetime)
+
+	if idleExpiry.Before(absoluteExpiry) {
+		return idleExpiry
+	}
+	return absoluteExpiry
+}
+
+// ShouldRenew reports whether a session last renewed at lastSeenAt is due to be renewed again.
+func (policy Policy) ShouldRenew(lastSeenAt time.Time, now time.Time) bool {
+	return now.Sub(lastSeenAt) >= policy.RenewInterval
+}
+
+// CreateSessionCookie creates a cookie holding a newly generated session id.
+func CreateSessionCookie(expiresAt time.Time) (http.Cookie, error) {
 	sessionID, err := generateSessionID()
 	if err != nil {
-		return http.Cookie{}, nil
+		return http.Cookie{}, err
 	}
-	thirtyDaysFromNow := time.Now().AddDate(0, 0, 30)
 
+	return NewSessionCookie(sessionID, expiresAt), nil
+}
+
+// NewSessionCookie creates a cookie for an existing session id, e.g. to reissue it with a new expiry.
+func NewSessionCookie(sessionID string, expiresAt time.Time) http.Cookie {
 	return http.Cookie{
-		Name:     SessionCookieName,
+		Name:     cookieOptions.Name,
 		Value:    sessionID,
-		Secure:   true,
+		Secure:   cookieOptions.Secure,
 		HttpOnly: true,
-		Expires:  thirtyDaysFromNow,
+		Expires:  expiresAt,
 		SameSite: http.SameSiteStrictMode,
 		Path:     "/",
-	}, nil
+	}
 }
 
 func CreateClearSessionCookie() http.Cookie {
 	return http.Cookie{
-		Name:     SessionCookieName,
+		Name:     cookieOptions.Name,
 		Value:    "",
-		Secure:   true,
+		Secure:   cookieOptions.Secure,
 		HttpOnly: true,
 		MaxAge:   -1,
 		SameSite: http.SameSiteStrictMode,
@@ -0,0 +1,183 @@
+// Connects a room or direct conversation to the chat websocket, renders incoming messages and
+// pages in history. The page describes which one it is through data attributes on #chat.
+(function () {
+	const chat = document.getElementById("chat");
+	const historyURL = chat.dataset.historyUrl;
+	const socketQuery = chat.dataset.socketQuery;
+	const readURL = chat.dataset.readUrl;
+	const roomID = Number(chat.dataset.roomId || 0);
+	const peerID = Number(chat.dataset.peerId || 0);
+	const isLive = chat.dataset.isLive === "true";
+
+	const messageList = document.getElementById("chat-messages");
+	const form = document.getElementById("chat-form");
+	const input = document.getElementById("chat-input");
+	const directMessagesLink = document.getElementById("nav-direct-messages");
+
+	const scheme = window.location.protocol === "https:" ? "wss:" : "ws:";
+	let socket;
+
+	// Ids of the oldest and newest rendered messages, used as history cursors.
+	let oldestID = 0;
+	let newestID = 0;
+	let hasOlder = true;
+	let isLoadingOlder = false;
+
+	function connect() {
+		socket = new WebSocket(scheme + "//" + window.location.host + "/ws?" + socketQuery);
+
+		socket.addEventListener("open", function () {
+			// Fill in anything sent while we were disconnected.
+			if (newestID > 0) {
+				loadNewer();
+			}
+		});
+
+		socket.addEventListener("message", function (event) {
+			handlePayload(JSON.parse(event.data));
+		});
+
+		// Try to reconnect if the server goes away.
+		socket.addEventListener("close", function () {
+			setTimeout(connect, 2000);
+		});
+	}
+
+	function handlePayload(payload) {
+		if (payload.type === "room" && payload.roomId === roomID) {
+			appendMessages([payload]);
+			return;
+		}
+
+		if (payload.type === "direct") {
+			if (peerID !== 0 && (payload.senderId === peerID || payload.recipientId === peerID)) {
+				appendMessages([payload]);
+				if (payload.senderId === peerID && readURL) {
+					fetch(readURL, { method: "POST", credentials: "same-origin" });
+				}
+			} else if (payload.senderId !== peerID && directMessagesLink) {
+				// A message from someone else, let the user know it is waiting.
+				directMessagesLink.classList.add("has-unread");
+			}
+		}
+	}
+
+	function fetchHistory(query) {
+		return fetch(historyURL + "?" + query, { credentials: "same-origin" })
+			.then(function (response) {
+				if (!response.ok) {
+					throw new Error("history request failed with " + response.status);
+				}
+				return response.json();
+			});
+	}
+
+	function loadLatest() {
+		return fetchHistory("").then(function (page) {
+			hasOlder = page.hasMore;
+			appendMessages(page.messages);
+		});
+	}
+
+	function loadOlder() {
+		if (!hasOlder || isLoadingOlder || oldestID === 0) {
+			return;
+		}
+		isLoadingOlder = true;
+
+		fetchHistory("before=" + oldestID).then(function (page) {
+			hasOlder = page.hasMore;
+			prependMessages(page.messages);
+		}).finally(function () {
+			isLoadingOlder = false;
+		});
+	}
+
+	function loadNewer() {
+		fetchHistory("after=" + newestID).then(function (page) {
+			appendMessages(page.messages);
+			if (page.hasMore) {
+				loadNewer();
+			}
+		});
+	}
+
+	function renderMessage(message) {
+		const item = document.createElement("li");
+		item.dataset.id = message.id;
+
+		const author = document.createElement("strong");
+		author.textContent = message.name;
+		author.title = message.username;
+
+		const time = document.createElement("small");
+		time.textContent = new Date(message.sentAt).toLocaleString();
+
+		const body = document.createElement("p");
+		body.textContent = message.body;
+
+		item.append(author, " ", time, body);
+		return item;
+	}
+
+	function appendMessages(messages) {
+		const wasAtBottom = messageList.scrollHeight - messageList.scrollTop - messageList.clientHeight < 20;
+
+		for (const message of messages) {
+			if (message.id <= newestID) {
+				continue;
+			}
+			messageList.append(renderMessage(message));
+			newestID = message.id;
+			if (oldestID === 0) {
+				oldestID = message.id;
+			}
+		}
+
+		if (wasAtBottom) {
+			messageList.scrollTop = messageList.scrollHeight;
+		}
+	}
+
+	function prependMessages(messages) {
+		// Keep the current view steady while older messages are inserted above it.
+		const previousHeight = messageList.scrollHeight;
+
+		for (let i = messages.length - 1; i >= 0; i--) {
+			if (messages[i].id >= oldestID) {
+				continue;
+			}
+			messageList.prepend(renderMessage(messages[i]));
+			oldestID = messages[i].id;
+		}
+
+		messageList.scrollTop += messageList.scrollHeight - previousHeight;
+	}
+
+	messageList.addEventListener("scroll", function () {
+		if (messageList.scrollTop < 50) {
+			loadOlder();
+		}
+	});
+
+	if (form) {
+		form.addEventListener("submit", function (event) {
+			event.preventDefault();
+
+			const body = input.value.trim();
+			if (body.length === 0 || !socket || socket.readyState !== WebSocket.OPEN) {
+				return;
+			}
+
+			socket.send(JSON.stringify({ body: body }));
+			input.value = "";
+		});
+	}
+
+	// Archived rooms are read only so there is nothing to listen for.
+	loadLatest().finally(function () {
+		if (isLive) {
+			connect();
+		}
+	});
+})();